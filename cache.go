@@ -0,0 +1,190 @@
+package debrepo
+
+import (
+	"bytes"
+	"hash"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// A metadataCache stores verified Release and index files on disk. Files are
+// named after their URL in the same way as APT names the files in
+// "/var/lib/apt/lists", so each Source has its own set of files.
+type metadataCache struct {
+	dir string
+}
+
+// cacheFileName returns the name of the cache file of the URL u: the URL
+// without its scheme, with "/" replaced by "_".
+func cacheFileName(u string) string {
+	if parsed, err := url.Parse(u); err == nil {
+		parsed.Scheme, parsed.User = "", nil
+		u = strings.TrimPrefix(parsed.String(), "//")
+	}
+	u = strings.Replace(u, "_", "%5f", -1)
+	return strings.Replace(u, "/", "_", -1)
+}
+
+func (mc *metadataCache) path(u string) string {
+	return filepath.Join(mc.dir, cacheFileName(u))
+}
+
+// load returns the cached contents of the file at u and the validators it was
+// retrieved with.
+func (mc *metadataCache) load(u string) ([]byte, CacheValidators, error) {
+	b, err := ioutil.ReadFile(mc.path(u))
+	if err != nil {
+		return nil, CacheValidators{}, err
+	}
+	var validators CacheValidators
+	if f, err := os.Open(mc.path(u) + ".meta"); err == nil {
+		p, err := NewParagraphReader(f).Read()
+		f.Close()
+		if err == nil {
+			validators.ETag = p.Get("ETag")
+			validators.LastModified = p.Get("Last-Modified")
+		}
+	}
+	return b, validators, nil
+}
+
+// store caches b as the contents of the file at u.
+func (mc *metadataCache) store(u string, b []byte, validators CacheValidators) error {
+	var p Paragraph
+	if len(validators.ETag) > 0 {
+		p.Set("ETag", validators.ETag)
+	}
+	if len(validators.LastModified) > 0 {
+		p.Set("Last-Modified", validators.LastModified)
+	}
+	meta := &bytes.Buffer{}
+	if len(p) > 0 {
+		if err := WriteParagraphs(meta, []Paragraph{p}); err != nil {
+			return err
+		}
+	}
+	if err := mc.writeFile(mc.path(u), b); err != nil {
+		return err
+	}
+	if err := mc.writeFile(mc.path(u)+".meta", meta.Bytes()); err != nil {
+		os.Remove(mc.path(u))
+		return err
+	}
+	return nil
+}
+
+// writeFile atomically replaces the contents of the cache file name with b.
+func (mc *metadataCache) writeFile(name string, b []byte) error {
+	f, err := mc.tempFile()
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(b); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	return os.Rename(f.Name(), name)
+}
+
+func (mc *metadataCache) tempFile() (*os.File, error) {
+	if err := os.MkdirAll(mc.dir, 0755); err != nil {
+		return nil, err
+	}
+	return ioutil.TempFile(mc.dir, ".partial-")
+}
+
+// openVerified opens the cached file at u if its contents match sum.
+func (mc *metadataCache) openVerified(u string, sum fileChecksum) (io.ReadCloser, bool) {
+	f, err := os.Open(mc.path(u))
+	if err != nil {
+		return nil, false
+	}
+	h := sum.Hash.New()
+	n, err := io.Copy(h, f)
+	if err != nil || n != sum.Length || !bytes.Equal(h.Sum(nil), sum.Sum) {
+		f.Close()
+		return nil, false
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		f.Close()
+		return nil, false
+	}
+	return f, true
+}
+
+// tee returns a ReadCloser reading from body which stores the data read in
+// the cache as the file at u once it has been read completely and matches
+// sum. If the cache can not be written, body is returned unchanged.
+func (mc *metadataCache) tee(u string, body io.ReadCloser, sum fileChecksum) io.ReadCloser {
+	f, err := mc.tempFile()
+	if err != nil {
+		return body
+	}
+	return &cachingReader{ReadCloser: body, f: f, path: mc.path(u), sum: sum, h: sum.Hash.New()}
+}
+
+// cachingReader copies the data read from a file into a temporary file, which
+// is moved into the cache when the file has been verified.
+type cachingReader struct {
+	io.ReadCloser
+	f    *os.File
+	path string
+	sum  fileChecksum
+	h    hash.Hash
+	n    int64
+}
+
+func (cr *cachingReader) Read(p []byte) (int, error) {
+	n, err := cr.ReadCloser.Read(p)
+	if cr.f == nil {
+		return n, err
+	}
+	cr.h.Write(p[:n])
+	cr.n += int64(n)
+	if _, werr := cr.f.Write(p[:n]); werr != nil {
+		cr.discard()
+		return n, err
+	}
+	if err == io.EOF {
+		cr.commit()
+	}
+	return n, err
+}
+
+func (cr *cachingReader) commit() {
+	if cr.n != cr.sum.Length || !bytes.Equal(cr.h.Sum(nil), cr.sum.Sum) {
+		cr.discard()
+		return
+	}
+	name := cr.f.Name()
+	err := cr.f.Close()
+	cr.f = nil
+	if err == nil {
+		err = os.Rename(name, cr.path)
+	}
+	if err != nil {
+		os.Remove(name)
+	}
+}
+
+func (cr *cachingReader) discard() {
+	cr.f.Close()
+	os.Remove(cr.f.Name())
+	cr.f = nil
+}
+
+func (cr *cachingReader) Close() error {
+	if cr.f != nil {
+		cr.discard()
+	}
+	return cr.ReadCloser.Close()
+}
@@ -1,20 +1,383 @@
 package debrepo
 
 import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"io/ioutil"
 	"net/http"
+	"net/url"
+	"strings"
 	"sync"
 
 	"golang.org/x/crypto/openpgp"
 )
 
+const (
+	// FileNotFound is returned when a file is not present in the repository.
+	FileNotFound = Error("file not found in repository")
+
+	// InvalidInRelease is returned when an InRelease file does not contain a
+	// clearsigned message.
+	InvalidInRelease = Error("InRelease file is not clearsigned")
+)
+
 // A Client is a Debian Repository client.
 type Client struct {
-	mu sync.Mutex
-	// sources SourceList
-	client  *http.Client
-	keyring openpgp.KeyRing
+	mu         sync.Mutex
+	sources    SourceList
+	transports map[string]Transport
+	keyring    openpgp.KeyRing
+	cache      *metadataCache
+	policy     HashPolicy
+	validity   ValidityPolicy
+	warn       func(source *Source, warning string)
+	// states holds the ReleaseState of the last accepted Release of each
+	// distribution, keyed by the URL of the directory holding its Release
+	// file. stateLocks serializes the check and update of the state of each
+	// distribution.
+	states     map[string]ReleaseState
+	stateLocks map[string]*sync.Mutex
+}
+
+// NewClient returns a Client which retrieves the repositories in sources.
+// Repository signatures are verified using keyring. Repositories with "http"
+// and "https" URIs are retrieved using client, or http.DefaultClient if it is
+// nil. "file" and "copy" URIs are read from the local file system. Transports
+// for other schemes may be added with RegisterTransport.
+func NewClient(sources SourceList, keyring openpgp.KeyRing, client *http.Client) *Client {
+	httpTransport := &HTTPTransport{Client: client}
+	return &Client{
+		sources: sources,
+		transports: map[string]Transport{
+			"http":  httpTransport,
+			"https": httpTransport,
+			"file":  FileTransport{},
+			"copy":  CopyTransport{},
+		},
+		keyring:    keyring,
+		policy:     DefaultHashPolicy,
+		validity:   DefaultValidityPolicy,
+		states:     make(map[string]ReleaseState),
+		stateLocks: make(map[string]*sync.Mutex),
+	}
+}
+
+// SetHashPolicy sets the HashPolicy which Release files must satisfy and
+// which determines the checksums used to verify index files. The default is
+// DefaultHashPolicy.
+func (c *Client) SetHashPolicy(p HashPolicy) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.policy = p
+}
+
+// SetWarningHandler sets a function which is called with warnings about a
+// Release file which was accepted, such as the use of weak checksums. Warnings
+// are discarded if no handler is set.
+func (c *Client) SetWarningHandler(h func(source *Source, warning string)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.warn = h
+}
+
+// RegisterTransport sets the Transport used to retrieve repositories whose
+// URIs use scheme, replacing the built-in Transport if there is one.
+func (c *Client) RegisterTransport(scheme string, t Transport) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.transports[strings.ToLower(scheme)] = t
 }
 
-// func NewClient(source SourceList, keyring openpgp.KeyRing, client *http.Client) *Client {
-// 	panic("Not Implemented")
-// }
+// SetCacheDir enables caching of verified Release and index files in dir,
+// which is created if it does not exist. Cached Release files are revalidated
+// with a conditional request when the transport supports it, so that an
+// unchanged distribution costs a single "304 Not Modified" response. Cached
+// index files are used without contacting the repository while they match the
+// checksums of the Release. An empty dir disables caching.
+func (c *Client) SetCacheDir(dir string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(dir) == 0 {
+		c.cache = nil
+		return
+	}
+	c.cache = &metadataCache{dir: dir}
+}
+
+// TrustRelease records release as the last accepted Release of the
+// distribution referenced by source. Subsequent calls to FetchRelease for the
+// distribution only accept a Release signed by a key listed in the Signed-By
+// field of release. The Date and Signed-By fields of release are recorded in
+// the ReleaseState of the distribution.
+func (c *Client) TrustRelease(source *Source, release *Release) error {
+	return c.SetReleaseState(source, ReleaseState{Date: release.Date, SignedBy: release.SignedBy})
+}
+
+// FetchReleases retrieves the Release of every Source in the client's
+// SourceList. The returned slice is in the same order as the SourceList.
+func (c *Client) FetchReleases() ([]*Release, error) {
+	releases := make([]*Release, 0, len(c.sources))
+	for _, source := range c.sources {
+		release, err := c.FetchRelease(source)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", source, err)
+		}
+		releases = append(releases, release)
+	}
+	return releases, nil
+}
+
+// FetchRelease downloads, verifies and parses the Release file of the
+// distribution referenced by source. The inline signed file
+// "dists/$DIST/InRelease" is tried first. If it is not present, the client
+// falls back to "dists/$DIST/Release" and its detached signature
+// "dists/$DIST/Release.gpg". For a flat repository the files are retrieved
+// from the exact path of the source instead of "dists/$DIST".
+//
+// If a Release of the distribution was previously accepted and its Signed-By
+// field is set, one of the valid signatures of the new Release must be made by
+// a listed key or UntrustedSigner is returned. The Signed-By field is kept in the
+// ReleaseState, so it is enforced across processes sharing a cache
+// directory.
+//
+// The Date and Valid-Until fields are checked against the ValidityPolicy of
+// the client. Valid-Until is ignored if the "check-valid-until" option of
+// source is disabled. A *StaleReleaseError is returned if the Release has
+// expired or if its Date is older than that of the last Release accepted for
+// the distribution, as recorded in its ReleaseState. ConflictingRelease is
+// returned if its Date is the same but its content differs.
+func (c *Client) FetchRelease(source *Source) (*Release, error) {
+	key, err := source.URL("")
+	if err != nil {
+		return nil, err
+	}
+	fetched, err := c.fetchRelease(source)
+	if err != nil {
+		return nil, err
+	}
+	unlock := c.lockReleaseState(key)
+	defer unlock()
+	if err := c.checkReleaseState(key, fetched.state, fetched.signers); err != nil {
+		return nil, err
+	}
+	if err := c.setReleaseState(key, fetched.state); err != nil {
+		return nil, err
+	}
+	// The files are only cached once the Release was accepted, so that a
+	// rejected Release does not replace the cached copy of the accepted one.
+	for _, f := range fetched.files {
+		c.storeCached(f.u, f.b, f.validators)
+	}
+	c.mu.Lock()
+	warn := c.warn
+	c.mu.Unlock()
+	if warn != nil {
+		for _, w := range fetched.warnings {
+			warn(source, w)
+		}
+	}
+	return fetched.release, nil
+}
+
+// A fetchedRelease is a verified and validated Release which has not been
+// checked against the ReleaseState of its distribution yet.
+type fetchedRelease struct {
+	release  *Release
+	signers  []*Signer
+	state    ReleaseState
+	warnings []string
+	// files holds the retrieved Release files, which are cached once the
+	// Release is accepted.
+	files []cachedFile
+}
+
+// A cachedFile is a retrieved file to be stored in the metadata cache.
+type cachedFile struct {
+	u          string
+	b          []byte
+	validators CacheValidators
+}
+
+func (c *Client) fetchRelease(source *Source) (*fetchedRelease, error) {
+	signed, signers, files, err := c.fetchSignedRelease(source)
+	if err != nil {
+		return nil, err
+	}
+	release, err := parseRelease(bytes.NewReader(signed))
+	if err != nil {
+		return nil, err
+	}
+	rv := &releaseValidator{
+		Release:         release,
+		flat:            source.IsFlat(),
+		policy:          c.hashPolicy(),
+		validity:        c.validityPolicy(),
+		checkValidUntil: source.CheckValidUntil(),
+	}
+	if err := rv.validate(); err != nil {
+		return nil, err
+	}
+	return &fetchedRelease{
+		release: release,
+		signers: signers,
+		state: ReleaseState{
+			Date:     release.Date,
+			SHA256:   sha256.Sum256(signed),
+			SignedBy: release.SignedBy,
+		},
+		warnings: rv.warnings,
+		files:    files,
+	}, nil
+}
+
+func (c *Client) hashPolicy() HashPolicy {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.policy
+}
+
+// checksum returns the strongest checksum of the file at path listed in
+// release, unless the hash policy of the client does not trust it.
+func (c *Client) checksum(release *Release, path string) (fileChecksum, bool) {
+	sum, ok := release.checksum(path)
+	if !ok || !c.hashPolicy().accepts(sum.Hash) {
+		return fileChecksum{}, false
+	}
+	return sum, true
+}
+
+// fetchSignedRelease retrieves the Release file of source and returns its
+// contents after verifying its signature, along with the retrieved files to be
+// cached if the Release is accepted.
+func (c *Client) fetchSignedRelease(source *Source) ([]byte, []*Signer, []cachedFile, error) {
+	inReleaseURL, err := source.InReleaseURL()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	b, validators, err := c.getCached(inReleaseURL)
+	if err == nil {
+		plaintext, signers, err := verifyInRelease(b, c.keyring, c.validityPolicy().now())
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		return plaintext, signers, []cachedFile{{inReleaseURL, b, validators}}, nil
+	}
+	if err != FileNotFound {
+		return nil, nil, nil, err
+	}
+
+	releaseURL, err := source.ReleaseURL()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	signatureURL, err := source.ReleaseGPGURL()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	release, releaseValidators, err := c.getCached(releaseURL)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	signature, signatureValidators, err := c.getCached(signatureURL)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	signers, err := verifyDetachedRelease(release, signature, c.keyring, c.validityPolicy().now())
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	files := []cachedFile{
+		{releaseURL, release, releaseValidators},
+		{signatureURL, signature, signatureValidators},
+	}
+	return release, signers, files, nil
+}
+
+// getCached retrieves the file at u. If the file is cached and the transport
+// supports conditional requests, the cached copy is returned if the file has
+// not changed. The validators of the returned contents are returned with it.
+func (c *Client) getCached(u string) ([]byte, CacheValidators, error) {
+	cache := c.metadataCache()
+	if cache == nil {
+		b, err := c.get(u)
+		return b, CacheValidators{}, err
+	}
+	parsed, t, err := c.transport(u)
+	if err != nil {
+		return nil, CacheValidators{}, err
+	}
+	ct, ok := t.(ConditionalTransport)
+	if !ok {
+		b, err := c.get(u)
+		return b, CacheValidators{}, err
+	}
+	cached, validators, err := cache.load(u)
+	if err != nil {
+		validators = CacheValidators{}
+	}
+	body, validators, err := ct.OpenIfModified(parsed, validators)
+	if err == NotModified && cached != nil {
+		return cached, validators, nil
+	}
+	if err != nil {
+		return nil, CacheValidators{}, err
+	}
+	defer body.Close()
+	b, err := ioutil.ReadAll(body)
+	if err != nil {
+		return nil, CacheValidators{}, err
+	}
+	return b, validators, nil
+}
+
+// storeCached caches the verified contents b of the file at u. Caching is
+// best effort and errors are ignored.
+func (c *Client) storeCached(u string, b []byte, validators CacheValidators) {
+	if cache := c.metadataCache(); cache != nil {
+		cache.store(u, b, validators)
+	}
+}
+
+func (c *Client) metadataCache() *metadataCache {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.cache
+}
+
+// get retrieves the file at u. FileNotFound is returned if the file does not
+// exist.
+func (c *Client) get(u string) ([]byte, error) {
+	body, err := c.open(u)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+	return ioutil.ReadAll(body)
+}
+
+// open returns the body of the file at u. The caller must close it.
+// FileNotFound is returned if the file does not exist.
+func (c *Client) open(u string) (io.ReadCloser, error) {
+	parsed, t, err := c.transport(u)
+	if err != nil {
+		return nil, err
+	}
+	return t.Open(parsed)
+}
+
+// transport parses u and returns the Transport registered for its scheme.
+func (c *Client) transport(u string) (*url.URL, Transport, error) {
+	parsed, err := url.Parse(u)
+	if err != nil {
+		return nil, nil, err
+	}
+	c.mu.Lock()
+	t, ok := c.transports[strings.ToLower(parsed.Scheme)]
+	c.mu.Unlock()
+	if !ok {
+		return nil, nil, UnsupportedScheme
+	}
+	return parsed, t, nil
+}
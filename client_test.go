@@ -0,0 +1,285 @@
+package debrepo
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/packet"
+)
+
+func newTestSource(t *testing.T, baseURI string) *Source {
+	source, err := ParseSource("deb " + baseURI + " jessie main")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return source
+}
+
+func TestClient_FetchRelease_DetachedSignature(t *testing.T) {
+	ts := newTestServer()
+	defer ts.Close()
+	source := newTestSource(t, ts.URL+ts.URIRoot())
+	c := NewClient(SourceList{source}, ts.KeyRing(), nil)
+	c.SetValidityPolicy(testValidity(ts.Time()))
+	r, err := c.FetchRelease(source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected, actual := ts.Distribution(), r.Codename; expected != actual {
+		t.Fatalf("expected=%v actual=%v", expected, actual)
+	}
+}
+
+func TestClient_FetchRelease_UnknownKey(t *testing.T) {
+	ts := newTestServer()
+	defer ts.Close()
+	source := newTestSource(t, ts.URL+ts.URIRoot())
+	c := NewClient(SourceList{source}, openpgp.EntityList{}, nil)
+	if _, err := c.FetchRelease(source); err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+func TestClient_FetchRelease_InRelease(t *testing.T) {
+	entity := newTestEntity(t)
+	inRelease := clearsignTestFile(t, testReleasePath, entity.PrivateKey)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debian/dists/jessie/InRelease", func(w http.ResponseWriter, r *http.Request) {
+		w.Write(inRelease)
+	})
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	source := newTestSource(t, ts.URL+"/debian")
+	c := NewClient(SourceList{source}, openpgp.EntityList{entity}, nil)
+	r, err := c.FetchRelease(source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected, actual := "jessie", r.Codename; expected != actual {
+		t.Fatalf("expected=%v actual=%v", expected, actual)
+	}
+
+	c = NewClient(SourceList{source}, (&testserver{}).KeyRing(), nil)
+	if _, err := c.FetchRelease(source); err == nil {
+		t.Fatal("expected error for InRelease signed by unknown key")
+	}
+}
+
+func TestClient_FetchRelease_FlatRepository(t *testing.T) {
+	entity := newTestEntity(t)
+	packages := readTestPackages(t)
+	release := fmt.Sprintf("Origin: Example\nDate: Sat, 25 Apr 2015 10:54:14 UTC\nSHA256:\n %x %d Packages\n",
+		sha256.Sum256(packages), len(packages))
+	inRelease := clearsignTestData(t, []byte(release), entity.PrivateKey)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/local/InRelease", func(w http.ResponseWriter, r *http.Request) {
+		w.Write(inRelease)
+	})
+	mux.HandleFunc("/local/Packages", func(w http.ResponseWriter, r *http.Request) {
+		w.Write(packages)
+	})
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	source, err := ParseSource("deb " + ts.URL + "/local ./")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := NewClient(SourceList{source}, openpgp.EntityList{entity}, nil)
+	r, err := c.FetchRelease(source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rc, err := c.FetchIndex(source, r, "Packages")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rc.Close()
+	b, err := ioutil.ReadAll(rc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(packages, b) {
+		t.Fatal("content mismatch")
+	}
+
+	// The Release of a repository using "dists" must list its components.
+	mux.HandleFunc("/local/dists/stable/InRelease", func(w http.ResponseWriter, r *http.Request) {
+		w.Write(inRelease)
+	})
+	source, err = ParseSource("deb " + ts.URL + "/local stable main")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.FetchRelease(source); err == nil {
+		t.Fatal("expected error for Release without components")
+	}
+}
+
+func TestClient_FetchReleases(t *testing.T) {
+	ts := newTestServer()
+	defer ts.Close()
+	source := newTestSource(t, ts.URL+ts.URIRoot())
+	c := NewClient(SourceList{source, source}, ts.KeyRing(), nil)
+	c.SetValidityPolicy(testValidity(ts.Time()))
+	releases, err := c.FetchReleases()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected, actual := 2, len(releases); expected != actual {
+		t.Fatalf("expected=%v actual=%v", expected, actual)
+	}
+}
+
+func TestClient_FetchRelease_SignedBy(t *testing.T) {
+	rotating, other := newTestEntity(t), newTestEntity(t)
+	release, err := ioutil.ReadFile(testReleasePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signedBy := fmt.Sprintf("Signed-By: %X\nMD5Sum:", rotating.Subkeys[0].PublicKey.Fingerprint)
+	release = bytes.Replace(release, []byte("MD5Sum:"), []byte(signedBy), 1)
+
+	var inRelease []byte
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debian/dists/jessie/InRelease", func(w http.ResponseWriter, r *http.Request) {
+		w.Write(inRelease)
+	})
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+	source := newTestSource(t, ts.URL+"/debian")
+	c := NewClient(SourceList{source}, openpgp.EntityList{rotating, other}, nil)
+
+	tests := []struct {
+		key   *packet.PrivateKey
+		valid bool
+	}{
+		{other.PrivateKey, true}, // nothing trusted yet
+		{rotating.Subkeys[0].PrivateKey, true},
+		{other.PrivateKey, false},
+		{rotating.PrivateKey, false}, // only the subkey is listed
+		{rotating.Subkeys[0].PrivateKey, true},
+	}
+	for i, tt := range tests {
+		inRelease = clearsignTestData(t, release, tt.key)
+		_, err := c.FetchRelease(source)
+		if expected, actual := tt.valid, err == nil; expected != actual {
+			t.Fatalf("test(%v): expected=%v actual=%v (%v)", i, expected, actual, err)
+		}
+		if !tt.valid && err != UntrustedSigner {
+			t.Fatalf("test(%v): expected=%v actual=%v", i, UntrustedSigner, err)
+		}
+	}
+}
+
+func TestClient_FetchRelease_SignedByRotation(t *testing.T) {
+	old, rotated := newTestEntity(t), newTestEntity(t)
+	release, err := ioutil.ReadFile(testReleasePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signedBy := fmt.Sprintf("Signed-By: %X\nMD5Sum:", rotated.PrimaryKey.Fingerprint)
+	release = bytes.Replace(release, []byte("MD5Sum:"), []byte(signedBy), 1)
+
+	var signature []byte
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debian/dists/jessie/Release", func(w http.ResponseWriter, r *http.Request) {
+		w.Write(release)
+	})
+	mux.HandleFunc("/debian/dists/jessie/Release.gpg", func(w http.ResponseWriter, r *http.Request) {
+		w.Write(signature)
+	})
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+	source := newTestSource(t, ts.URL+"/debian")
+	c := NewClient(SourceList{source}, openpgp.EntityList{old, rotated}, nil)
+
+	tests := []struct {
+		keys  []*openpgp.Entity
+		valid bool
+	}{
+		{[]*openpgp.Entity{old}, true}, // nothing trusted yet
+		{[]*openpgp.Entity{old, rotated}, true},
+		{[]*openpgp.Entity{rotated, old}, true},
+		{[]*openpgp.Entity{old}, false},
+	}
+	for i, tt := range tests {
+		signature = detachSignTestData(t, release, tt.keys...)
+		_, err := c.FetchRelease(source)
+		if expected, actual := tt.valid, err == nil; expected != actual {
+			t.Fatalf("test(%v): expected=%v actual=%v (%v)", i, expected, actual, err)
+		}
+		if !tt.valid && err != UntrustedSigner {
+			t.Fatalf("test(%v): expected=%v actual=%v", i, UntrustedSigner, err)
+		}
+	}
+}
+
+func TestClient_FetchRelease_SignedByPersisted(t *testing.T) {
+	rotating, other := newTestEntity(t), newTestEntity(t)
+	release, err := ioutil.ReadFile(testReleasePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signedBy := fmt.Sprintf("Signed-By: %X\nMD5Sum:", rotating.Subkeys[0].PublicKey.Fingerprint)
+	release = bytes.Replace(release, []byte("MD5Sum:"), []byte(signedBy), 1)
+
+	var inRelease []byte
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debian/dists/jessie/InRelease", func(w http.ResponseWriter, r *http.Request) {
+		w.Write(inRelease)
+	})
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+	dir, err := ioutil.TempDir("", "debrepo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	source := newTestSource(t, ts.URL+"/debian")
+
+	tests := []struct {
+		key   *packet.PrivateKey
+		valid bool
+	}{
+		{rotating.Subkeys[0].PrivateKey, true},
+		{other.PrivateKey, false},
+		{rotating.Subkeys[0].PrivateKey, true},
+	}
+	for i, tt := range tests {
+		// Each fetch is made by a new client sharing the cache directory.
+		c := NewClient(SourceList{source}, openpgp.EntityList{rotating, other}, nil)
+		c.SetCacheDir(dir)
+		inRelease = clearsignTestData(t, release, tt.key)
+		_, err := c.FetchRelease(source)
+		if expected, actual := tt.valid, err == nil; expected != actual {
+			t.Fatalf("test(%v): expected=%v actual=%v (%v)", i, expected, actual, err)
+		}
+		if !tt.valid && err != UntrustedSigner {
+			t.Fatalf("test(%v): expected=%v actual=%v", i, UntrustedSigner, err)
+		}
+	}
+}
+
+func TestClient_TrustRelease(t *testing.T) {
+	ts := newTestServer()
+	defer ts.Close()
+	source := newTestSource(t, ts.URL+ts.URIRoot())
+	c := NewClient(SourceList{source}, ts.KeyRing(), nil)
+	c.SetValidityPolicy(testValidity(ts.Time()))
+	if err := c.TrustRelease(source, &Release{SignedBy: [][20]byte{{0x01}}}); err != nil {
+		t.Fatal(err)
+	}
+	_, err := c.FetchRelease(source)
+	if expected, actual := UntrustedSigner, err; expected != actual {
+		t.Fatalf("expected=%v actual=%v", expected, actual)
+	}
+}
@@ -0,0 +1,274 @@
+package debrepo
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+const (
+	// InvalidParagraph is returned on malformed control file paragraphs.
+	InvalidParagraph = Error("unable to parse control file paragraph")
+)
+
+// maxLineLength is the longest line accepted in a control file.
+const maxLineLength = 1024 * 1024
+
+// A Field is a single field of a control file paragraph.
+//
+// Values spanning multiple lines are stored with lines separated by "\n" and
+// without the leading space of continuation lines. A multiline value whose
+// first line is empty, such as the checksum lists of a Release file, begins
+// with "\n".
+type Field struct {
+	Name  string
+	Value string
+}
+
+// A Paragraph is a block of fields in a control file using the deb822 format.
+// The order of fields is preserved. Field names are case-insensitive.
+// See https://manpages.debian.org/deb822
+type Paragraph []Field
+
+// Lookup returns the value of the field name and whether it is present.
+func (p Paragraph) Lookup(name string) (string, bool) {
+	for _, f := range p {
+		if strings.EqualFold(f.Name, name) {
+			return f.Value, true
+		}
+	}
+	return "", false
+}
+
+// Get returns the value of the field name, or "" if it is not present.
+func (p Paragraph) Get(name string) string {
+	value, _ := p.Lookup(name)
+	return value
+}
+
+// Set replaces the value of the field name. The field is appended if it is
+// not present.
+func (p *Paragraph) Set(name, value string) {
+	for i, f := range *p {
+		if strings.EqualFold(f.Name, name) {
+			(*p)[i].Value = value
+			return
+		}
+	}
+	*p = append(*p, Field{Name: name, Value: value})
+}
+
+// Del removes the field name.
+func (p *Paragraph) Del(name string) {
+	for i, f := range *p {
+		if strings.EqualFold(f.Name, name) {
+			*p = append((*p)[:i], (*p)[i+1:]...)
+			return
+		}
+	}
+}
+
+// A ParagraphReader reads paragraphs from a deb822 control file.
+//
+// Comment lines starting with "#" are ignored. If the file is an OpenPGP
+// cleartext signed message, the armor is stripped and only the signed content
+// is read. The signature is not verified; use ReadInRelease for that.
+type ParagraphReader struct {
+	scanner *bufio.Scanner
+	started bool
+	signed  bool
+	done    bool
+	// line is the number of the last line read and start the number of the
+	// first line of the last paragraph returned. lines holds the line number
+	// of each field of the last paragraph returned.
+	line  int
+	start int
+	lines []int
+	// skipInvalid makes Read skip malformed lines instead of returning
+	// InvalidParagraph. The line numbers of skipped lines are appended to
+	// invalid.
+	skipInvalid bool
+	invalid     []int
+}
+
+// NewParagraphReader returns a ParagraphReader reading from r.
+func NewParagraphReader(r io.Reader) *ParagraphReader {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxLineLength)
+	return &ParagraphReader{scanner: scanner}
+}
+
+// Read returns the next Paragraph. io.EOF is returned when there are no more
+// paragraphs.
+func (pr *ParagraphReader) Read() (Paragraph, error) {
+	var p Paragraph
+	for !pr.done {
+		line, ok := pr.nextLine()
+		if !ok {
+			break
+		}
+		if len(strings.TrimSpace(line)) == 0 {
+			if len(p) > 0 {
+				return p, nil
+			}
+			continue
+		}
+		if line[0] == '#' {
+			continue
+		}
+		if len(p) == 0 {
+			pr.start = pr.line
+			pr.lines = nil
+		}
+		if line[0] == ' ' || line[0] == '\t' {
+			if len(p) == 0 {
+				if pr.skipInvalid {
+					pr.invalid = append(pr.invalid, pr.line)
+					continue
+				}
+				return nil, InvalidParagraph
+			}
+			p[len(p)-1].Value += "\n" + line[1:]
+			continue
+		}
+		i := strings.Index(line, ":")
+		if i <= 0 || strings.ContainsAny(line[:i], " \t") {
+			if pr.skipInvalid {
+				pr.invalid = append(pr.invalid, pr.line)
+				continue
+			}
+			return nil, InvalidParagraph
+		}
+		if len(p) == 0 {
+			pr.start = pr.line
+		}
+		p = append(p, Field{
+			Name:  line[:i],
+			Value: strings.TrimSpace(line[i+1:]),
+		})
+		pr.lines = append(pr.lines, pr.line)
+	}
+	if err := pr.scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(p) == 0 {
+		return nil, io.EOF
+	}
+	return p, nil
+}
+
+// nextLine returns the next line of paragraph content, removing the OpenPGP
+// cleartext armor if present.
+func (pr *ParagraphReader) nextLine() (string, bool) {
+	if !pr.scanner.Scan() {
+		return "", false
+	}
+	pr.line++
+	line := strings.TrimRight(pr.scanner.Text(), "\r")
+	if !pr.started && len(strings.TrimSpace(line)) > 0 {
+		pr.started = true
+		if line == "-----BEGIN PGP SIGNED MESSAGE-----" {
+			pr.signed = true
+			// Skip the armor headers which end with a blank line.
+			for pr.scanner.Scan() {
+				pr.line++
+				if len(strings.TrimSpace(pr.scanner.Text())) == 0 {
+					break
+				}
+			}
+			return "", true
+		}
+	}
+	if pr.signed {
+		if line == "-----BEGIN PGP SIGNATURE-----" {
+			pr.done = true
+			return "", false
+		}
+		line = strings.TrimPrefix(line, "- ")
+	}
+	return line, true
+}
+
+// ReadParagraphs returns all paragraphs of a deb822 control file.
+func ReadParagraphs(r io.Reader) ([]Paragraph, error) {
+	var paragraphs []Paragraph
+	pr := NewParagraphReader(r)
+	for {
+		p, err := pr.Read()
+		if err == io.EOF {
+			return paragraphs, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		paragraphs = append(paragraphs, p)
+	}
+}
+
+// A ParagraphWriter writes paragraphs to a deb822 control file.
+type ParagraphWriter struct {
+	w       *bufio.Writer
+	written bool
+}
+
+// NewParagraphWriter returns a ParagraphWriter writing to w. Flush must be
+// called once all paragraphs have been written.
+func NewParagraphWriter(w io.Writer) *ParagraphWriter {
+	return &ParagraphWriter{w: bufio.NewWriter(w)}
+}
+
+// Write writes p, separated from any previous paragraph by a blank line.
+func (pw *ParagraphWriter) Write(p Paragraph) error {
+	if pw.written {
+		if err := pw.w.WriteByte('\n'); err != nil {
+			return err
+		}
+	}
+	for _, f := range p {
+		if err := pw.writeField(f); err != nil {
+			return err
+		}
+	}
+	pw.written = true
+	return nil
+}
+
+func (pw *ParagraphWriter) writeField(f Field) error {
+	if len(f.Name) == 0 || strings.ContainsAny(f.Name, ": \t\n") || f.Name[0] == '#' || f.Name[0] == '-' {
+		return fmt.Errorf("invalid field name %q", f.Name)
+	}
+	lines := strings.Split(f.Value, "\n")
+	if len(lines[0]) > 0 {
+		if _, err := fmt.Fprintf(pw.w, "%s: %s\n", f.Name, lines[0]); err != nil {
+			return err
+		}
+	} else if _, err := fmt.Fprintf(pw.w, "%s:\n", f.Name); err != nil {
+		return err
+	}
+	for _, line := range lines[1:] {
+		if len(strings.TrimSpace(line)) == 0 {
+			return fmt.Errorf("field %s: empty continuation line", f.Name)
+		}
+		if _, err := fmt.Fprintf(pw.w, " %s\n", line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Flush writes any buffered data to the underlying io.Writer.
+func (pw *ParagraphWriter) Flush() error {
+	return pw.w.Flush()
+}
+
+// WriteParagraphs writes paragraphs to w as a deb822 control file.
+func WriteParagraphs(w io.Writer, paragraphs []Paragraph) error {
+	pw := NewParagraphWriter(w)
+	for _, p := range paragraphs {
+		if err := pw.Write(p); err != nil {
+			return err
+		}
+	}
+	return pw.Flush()
+}
@@ -0,0 +1,140 @@
+package debrepo
+
+import (
+	"bytes"
+	"io/ioutil"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const testControlFile = `Package: hello
+Version: 2.10-1
+# a comment between fields
+Depends: libc6 (>= 2.14),
+ dpkg (>= 1.15)
+Description: example package based on GNU hello
+ The GNU hello program produces a familiar, friendly greeting.
+ .
+ It allows non-programmers to use a classic computer science tool.
+
+Package: hello-traditional
+Checksums-Sha256:
+ 0123456789abcdef 100 hello_2.10.orig.tar.gz
+ fedcba9876543210 200 hello_2.10-1.debian.tar.xz
+`
+
+func TestParagraphReader_Read(t *testing.T) {
+	paragraphs, err := ReadParagraphs(strings.NewReader(testControlFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []Paragraph{
+		{
+			{"Package", "hello"},
+			{"Version", "2.10-1"},
+			{"Depends", "libc6 (>= 2.14),\ndpkg (>= 1.15)"},
+			{"Description", "example package based on GNU hello\n" +
+				"The GNU hello program produces a familiar, friendly greeting.\n" +
+				".\n" +
+				"It allows non-programmers to use a classic computer science tool."},
+		},
+		{
+			{"Package", "hello-traditional"},
+			{"Checksums-Sha256", "\n0123456789abcdef 100 hello_2.10.orig.tar.gz\n" +
+				"fedcba9876543210 200 hello_2.10-1.debian.tar.xz"},
+		},
+	}
+	if !reflect.DeepEqual(expected, paragraphs) {
+		t.Fatalf("expected=%q actual=%q", expected, paragraphs)
+	}
+}
+
+func TestParagraphReader_Signed(t *testing.T) {
+	signed := "-----BEGIN PGP SIGNED MESSAGE-----\n" +
+		"Hash: SHA256\n" +
+		"\n" +
+		"Origin: Debian\n" +
+		"- -Dash: escaped\n" +
+		"-----BEGIN PGP SIGNATURE-----\n" +
+		"\n" +
+		"iQIcBAABCAAGBQJW\n" +
+		"-----END PGP SIGNATURE-----\n"
+	paragraphs, err := ReadParagraphs(strings.NewReader(signed))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []Paragraph{{{"Origin", "Debian"}, {"-Dash", "escaped"}}}
+	if !reflect.DeepEqual(expected, paragraphs) {
+		t.Fatalf("expected=%q actual=%q", expected, paragraphs)
+	}
+}
+
+func TestParagraphReader_Invalid(t *testing.T) {
+	tests := []string{
+		" leading continuation",
+		"Field without colon",
+		": no name",
+		"Field name: value",
+	}
+	for i, tt := range tests {
+		if _, err := ReadParagraphs(strings.NewReader(tt)); err != InvalidParagraph {
+			t.Fatalf("test(%v): expected=%v actual=%v", i, InvalidParagraph, err)
+		}
+	}
+}
+
+func TestParagraphWriter_RoundTrip(t *testing.T) {
+	tests := []string{
+		strings.Replace(testControlFile, "# a comment between fields\n", "", 1),
+	}
+	release, err := ioutil.ReadFile("testdata/repo/root/debian/dists/jessie/Release")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests = append(tests, string(release))
+	for i, tt := range tests {
+		paragraphs, err := ReadParagraphs(strings.NewReader(tt))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var actual bytes.Buffer
+		if err := WriteParagraphs(&actual, paragraphs); err != nil {
+			t.Fatal(err)
+		}
+		if expected := tt; expected != actual.String() {
+			t.Fatalf("test(%v): round trip mismatch:\n%s", i, actual.String())
+		}
+	}
+}
+
+func TestParagraphWriter_Invalid(t *testing.T) {
+	tests := []Paragraph{
+		{{"", "value"}},
+		{{"Bad Name", "value"}},
+		{{"#Comment", "value"}},
+		{{"Description", "synopsis\n\nblank line"}},
+	}
+	for i, tt := range tests {
+		if err := WriteParagraphs(ioutil.Discard, []Paragraph{tt}); err == nil {
+			t.Fatalf("test(%v): expected error", i)
+		}
+	}
+}
+
+func TestParagraph_Fields(t *testing.T) {
+	p := Paragraph{{"Package", "hello"}, {"Version", "1.0"}}
+	if expected, actual := "hello", p.Get("package"); expected != actual {
+		t.Fatalf("expected=%v actual=%v", expected, actual)
+	}
+	if _, ok := p.Lookup("Depends"); ok {
+		t.Fatal("expected Depends to be absent")
+	}
+	p.Set("VERSION", "2.0")
+	p.Set("Depends", "libc6")
+	p.Del("Package")
+	expected := Paragraph{{"Version", "2.0"}, {"Depends", "libc6"}}
+	if !reflect.DeepEqual(expected, p) {
+		t.Fatalf("expected=%v actual=%v", expected, p)
+	}
+}
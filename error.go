@@ -1,8 +1,88 @@
 package debrepo
 
+import (
+	"fmt"
+	"time"
+)
+
 // Error is a const error type.
 type Error string
 
 func (e Error) Error() string {
 	return string(e)
 }
+
+// A SourceListError reports an invalid entry in a source list.
+type SourceListError struct {
+	// File is the path of the source list file. It is empty if the source
+	// list was not read from a file.
+	File string
+	// Line is the line number of the invalid entry. For deb822 style sources
+	// it is the first line of the stanza, unless the stanza itself is
+	// malformed.
+	Line int
+	Err  error
+}
+
+func (e *SourceListError) Error() string {
+	if len(e.File) == 0 {
+		return fmt.Sprintf("line %d: %v", e.Line, e.Err)
+	}
+	return fmt.Sprintf("%s:%d: %v", e.File, e.Line, e.Err)
+}
+
+// A ParseError reports a problem found while parsing a control file, such as
+// a Release file.
+type ParseError struct {
+	// File is the name of the file. It is empty if the file was not read
+	// from a named file.
+	File string
+	// Line is the line number of the problem. It is zero if the problem is
+	// not tied to a line, such as a missing field.
+	Line int
+	// Field is the name of the field containing the problem. It is empty if
+	// the problem is not tied to a field.
+	Field string
+	Err   error
+}
+
+func (e *ParseError) Error() string {
+	msg := e.Err.Error()
+	if len(e.Field) > 0 {
+		msg = e.Field + ": " + msg
+	}
+	switch {
+	case len(e.File) > 0 && e.Line > 0:
+		return fmt.Sprintf("%s:%d: %s", e.File, e.Line, msg)
+	case len(e.File) > 0:
+		return fmt.Sprintf("%s: %s", e.File, msg)
+	case e.Line > 0:
+		return fmt.Sprintf("line %d: %s", e.Line, msg)
+	}
+	return msg
+}
+
+// Unwrap returns the cause of the error.
+func (e *ParseError) Unwrap() error { return e.Err }
+
+// A StaleReleaseError is returned when a Release is rejected because it has
+// expired or is older than the last Release accepted for its Source, which
+// may indicate that a mirror is serving outdated metadata in a freeze or
+// rollback attack.
+type StaleReleaseError struct {
+	// Date is the Date of the rejected Release.
+	Date time.Time
+	// LastDate is the Date of the last accepted Release. It is zero if the
+	// Release was rejected because it expired.
+	LastDate time.Time
+	// ValidUntil is the Valid-Until time of the Release if it expired.
+	ValidUntil time.Time
+}
+
+func (e *StaleReleaseError) Error() string {
+	if !e.ValidUntil.IsZero() {
+		return fmt.Sprintf("release file expired at %s", e.ValidUntil.Format(time.RFC1123))
+	}
+	return fmt.Sprintf("release file dated %s is older than the last accepted release dated %s",
+		e.Date.Format(time.RFC1123), e.LastDate.Format(time.RFC1123))
+}
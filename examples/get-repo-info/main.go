@@ -27,9 +27,11 @@ func main() {
 
 	source, _ := debrepo.ParseSource("deb http://ftp.debian.org/debian squeeze main contrib non-free")
 	sourceList := debrepo.SourceList([]*debrepo.Source{source})
-	_ = sourceList
-
-	// client := debrepo.NewClient(sources, keyring, nil)
-	// _ = client
 
+	client := debrepo.NewClient(sourceList, keyring, nil)
+	release, err := client.FetchRelease(source)
+	if err != nil {
+		log.Fatalf("error fetching release: %v\n", err)
+	}
+	log.Printf("%s %s (%s)\n", release.Origin, release.Version, release.Codename)
 }
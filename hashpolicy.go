@@ -0,0 +1,102 @@
+package debrepo
+
+import (
+	"crypto"
+	"fmt"
+)
+
+const (
+	// InsufficientHashes is returned when a Release file has no checksums of
+	// a hash function accepted by the HashPolicy.
+	InsufficientHashes = Error("release file has no sufficiently strong checksums")
+
+	// MissingRequiredHash is returned when a Release file lacks the checksums
+	// of a hash function required by the HashPolicy.
+	MissingRequiredHash = Error("release file lacks required checksums")
+)
+
+// A HashPolicy determines which checksums of a Release file are trusted to
+// verify the files of a repository.
+type HashPolicy struct {
+	// Minimum is the weakest hash function whose checksums are trusted.
+	// Weaker checksums are ignored, so files listed only with weaker
+	// checksums can not be retrieved. A Release file without any trusted
+	// checksums is rejected with InsufficientHashes.
+	Minimum crypto.Hash
+	// Required lists the hash functions whose checksums must be present in
+	// a Release file. A Release file lacking any of them is rejected with
+	// MissingRequiredHash.
+	Required []crypto.Hash
+	// Warn is the weakest hash function which is trusted without a warning.
+	// A warning is reported for a Release file whose strongest checksums are
+	// weaker.
+	Warn crypto.Hash
+}
+
+// DefaultHashPolicy mirrors APT, which considers MD5 and SHA1 checksums
+// untrusted and refuses repositories which only provide those.
+var DefaultHashPolicy = HashPolicy{Minimum: crypto.SHA256, Warn: crypto.SHA256}
+
+// hashStrengths orders the hash functions used in Release files from weakest
+// to strongest.
+var hashStrengths = map[crypto.Hash]int{
+	crypto.MD5:    1,
+	crypto.SHA1:   2,
+	crypto.SHA256: 3,
+	crypto.SHA512: 4,
+}
+
+// accepts reports whether checksums of h are trusted by the policy.
+func (p HashPolicy) accepts(h crypto.Hash) bool {
+	return hashStrengths[h] >= hashStrengths[p.Minimum]
+}
+
+// Check returns an error if release does not satisfy the policy. Warnings
+// about the use of weak hash functions are returned for an accepted release.
+func (p HashPolicy) Check(release *Release) (warnings []string, err error) {
+	hashes := release.hashes()
+	for _, required := range p.Required {
+		if !containsHash(hashes, required) {
+			return nil, MissingRequiredHash
+		}
+	}
+	if len(hashes) == 0 {
+		return nil, InsufficientHashes
+	}
+	strongest := hashes[len(hashes)-1]
+	if !p.accepts(strongest) {
+		return nil, InsufficientHashes
+	}
+	if hashStrengths[strongest] < hashStrengths[p.Warn] {
+		warnings = append(warnings, fmt.Sprintf("release file uses weak %v checksums", strongest))
+	}
+	return warnings, nil
+}
+
+// hashes returns the hash functions of the checksum sections present in r,
+// from weakest to strongest.
+func (r *Release) hashes() []crypto.Hash {
+	var hashes []crypto.Hash
+	if len(r.MD5Sum) > 0 {
+		hashes = append(hashes, crypto.MD5)
+	}
+	if len(r.SHA1) > 0 {
+		hashes = append(hashes, crypto.SHA1)
+	}
+	if len(r.SHA256) > 0 {
+		hashes = append(hashes, crypto.SHA256)
+	}
+	if len(r.SHA512) > 0 {
+		hashes = append(hashes, crypto.SHA512)
+	}
+	return hashes
+}
+
+func containsHash(hashes []crypto.Hash, h crypto.Hash) bool {
+	for _, hh := range hashes {
+		if hh == h {
+			return true
+		}
+	}
+	return false
+}
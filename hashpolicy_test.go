@@ -0,0 +1,118 @@
+package debrepo
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/sha1"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"regexp"
+	"testing"
+
+	"golang.org/x/crypto/openpgp"
+)
+
+func TestHashPolicy_Check(t *testing.T) {
+	md5Only := &Release{MD5Sum: map[string]MD5FileMetaData{"Packages": {}}}
+	sha1Only := &Release{
+		MD5Sum: map[string]MD5FileMetaData{"Packages": {}},
+		SHA1:   map[string]SHA1FileMetaData{"Packages": {}},
+	}
+	sha256Only := &Release{SHA256: map[string]SHA256FileMetaData{"Packages": {}}}
+	weak := HashPolicy{Minimum: crypto.SHA1, Warn: crypto.SHA256}
+	tests := []struct {
+		policy   HashPolicy
+		release  *Release
+		warnings []string
+		err      error
+	}{
+		{DefaultHashPolicy, md5Only, nil, InsufficientHashes},
+		{DefaultHashPolicy, sha1Only, nil, InsufficientHashes},
+		{DefaultHashPolicy, sha256Only, nil, nil},
+		{DefaultHashPolicy, &Release{}, nil, InsufficientHashes},
+		{weak, md5Only, nil, InsufficientHashes},
+		{weak, sha1Only, []string{"release file uses weak SHA-1 checksums"}, nil},
+		{weak, sha256Only, nil, nil},
+		{HashPolicy{Required: []crypto.Hash{crypto.SHA512}}, sha256Only, nil, MissingRequiredHash},
+		{HashPolicy{Required: []crypto.Hash{crypto.MD5, crypto.SHA1}}, sha1Only, nil, nil},
+		{HashPolicy{}, md5Only, nil, nil},
+	}
+	for i, tt := range tests {
+		warnings, err := tt.policy.Check(tt.release)
+		if expected, actual := tt.err, err; expected != actual {
+			t.Fatalf("test(%v): error: expected=%v actual=%v", i, expected, actual)
+		}
+		if expected, actual := tt.warnings, warnings; !reflect.DeepEqual(expected, actual) {
+			t.Fatalf("test(%v): warnings: expected=%v actual=%v", i, expected, actual)
+		}
+	}
+}
+
+func TestRelease_Validate_RejectsWeakHashes(t *testing.T) {
+	release, err := ioutil.ReadFile(testReleasePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Keep the MD5Sum and SHA1 sections only.
+	release = regexp.MustCompile(`(?s)SHA256:.*`).ReplaceAll(release, nil)
+	_, err = ReadRelease(bytes.NewReader(release))
+	if perr, ok := err.(*ParseError); !ok || perr.Err != InsufficientHashes {
+		t.Fatalf("expected=%v actual=%v", InsufficientHashes, err)
+	}
+}
+
+func TestClient_SetHashPolicy(t *testing.T) {
+	entity := newTestEntity(t)
+	packages := readTestPackages(t)
+	release := fmt.Sprintf("Origin: Example\nDate: Sat, 25 Apr 2015 10:54:14 UTC\nSHA1:\n %x %d Packages\n",
+		sha1.Sum(packages), len(packages))
+	inRelease := clearsignTestData(t, []byte(release), entity.PrivateKey)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/local/InRelease", func(w http.ResponseWriter, r *http.Request) {
+		w.Write(inRelease)
+	})
+	mux.HandleFunc("/local/Packages", func(w http.ResponseWriter, r *http.Request) {
+		w.Write(packages)
+	})
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+	source, err := ParseSource("deb " + ts.URL + "/local ./")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := NewClient(SourceList{source}, openpgp.EntityList{entity}, nil)
+	if _, err := c.FetchRelease(source); err != InsufficientHashes {
+		t.Fatalf("expected=%v actual=%v", InsufficientHashes, err)
+	}
+
+	var warnings []string
+	c.SetHashPolicy(HashPolicy{Minimum: crypto.SHA1, Warn: crypto.SHA256})
+	c.SetWarningHandler(func(s *Source, warning string) {
+		if s != source {
+			t.Fatalf("unexpected source %v", s)
+		}
+		warnings = append(warnings, warning)
+	})
+	r, err := c.FetchRelease(source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected, actual := []string{"release file uses weak SHA-1 checksums"}, warnings; !reflect.DeepEqual(expected, actual) {
+		t.Fatalf("expected=%v actual=%v", expected, actual)
+	}
+	rc, err := c.FetchIndex(source, r, "Packages")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rc.Close()
+
+	// Checksums weaker than the minimum are not used to verify files.
+	c.SetHashPolicy(DefaultHashPolicy)
+	if _, err := c.FetchIndex(source, r, "Packages"); err != FileNotInRelease {
+		t.Fatalf("expected=%v actual=%v", FileNotInRelease, err)
+	}
+}
@@ -0,0 +1,231 @@
+package debrepo
+
+import (
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"crypto"
+	"encoding/hex"
+	"hash"
+	"io"
+	"io/ioutil"
+	"path"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/ulikunitz/xz"
+	"github.com/ulikunitz/xz/lzma"
+)
+
+const (
+	// FileNotInRelease is returned when a requested index file is not listed
+	// in the Release file of the distribution.
+	FileNotInRelease = Error("file not listed in release")
+
+	// HashMismatch is returned when a downloaded file does not match the size
+	// or checksum listed in the Release file.
+	HashMismatch = Error("file does not match checksum in release")
+)
+
+// compression is a compression format used for repository index files.
+type compression struct {
+	ext       string
+	newReader func(r io.Reader) (io.ReadCloser, error)
+}
+
+// compressions lists the supported compression formats in order of
+// preference. The uncompressed file is the last resort.
+var compressions = []compression{
+	{".xz", func(r io.Reader) (io.ReadCloser, error) {
+		xr, err := xz.NewReader(r)
+		return ioutil.NopCloser(xr), err
+	}},
+	{".zst", func(r io.Reader) (io.ReadCloser, error) {
+		zr, err := zstd.NewReader(r)
+		if err != nil {
+			return nil, err
+		}
+		return zr.IOReadCloser(), nil
+	}},
+	{".bz2", func(r io.Reader) (io.ReadCloser, error) {
+		return ioutil.NopCloser(bzip2.NewReader(r)), nil
+	}},
+	{".lzma", func(r io.Reader) (io.ReadCloser, error) {
+		lr, err := lzma.NewReader(r)
+		return ioutil.NopCloser(lr), err
+	}},
+	{".gz", func(r io.Reader) (io.ReadCloser, error) {
+		return gzip.NewReader(r)
+	}},
+	{"", func(r io.Reader) (io.ReadCloser, error) {
+		return ioutil.NopCloser(r), nil
+	}},
+}
+
+// FetchIndex downloads an index file of the distribution referenced by
+// source, such as "main/binary-amd64/Packages". name is relative to the
+// "dists/$DIST" directory, or to the exact path of a flat repository whose
+// indices are named "Packages" or "Sources", and must not include a
+// compression extension. release must be the verified Release of the
+// distribution.
+//
+// The most preferred compressed variant of name listed in release is
+// downloaded and decompressed while it is read. The download is checked
+// against the size and checksum listed in release, as is the uncompressed
+// content if release lists it. Checksums which the hash policy of the client
+// does not trust are ignored. If release enables Acquire-By-Hash, files are
+// requested by checksum so that a mirror being updated is never seen in an
+// inconsistent state. HashMismatch is returned by Read at the end of
+// the stream if either check fails. The caller must close the returned
+// ReadCloser.
+func (c *Client) FetchIndex(source *Source, release *Release, name string) (io.ReadCloser, error) {
+	listed := false
+	for _, comp := range compressions {
+		sum, ok := c.checksum(release, name+comp.ext)
+		if !ok {
+			continue
+		}
+		listed = true
+		body, err := c.openIndexFile(source, release, name+comp.ext, sum)
+		if err == FileNotFound {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		var uncompressed *fileChecksum
+		if u, ok := c.checksum(release, name); ok && len(comp.ext) > 0 {
+			uncompressed = &u
+		}
+		return newIndexReader(body, comp, sum, uncompressed)
+	}
+	if listed {
+		return nil, FileNotFound
+	}
+	return nil, FileNotInRelease
+}
+
+// openIndexFile opens the file at name, relative to the directory holding the
+// Release file. If the client has a cache directory holding a copy of the
+// file matching sum, the copy is used. If the repository supports
+// Acquire-By-Hash, the file is requested from its "by-hash" location first,
+// falling back to the canonical location if it is not found there.
+// See https://wiki.debian.org/DebianRepository/Format#indices_acquisition_via_hashsums_.28by-hash.29
+func (c *Client) openIndexFile(source *Source, release *Release, name string, sum fileChecksum) (io.ReadCloser, error) {
+	u, err := source.URL(name)
+	if err != nil {
+		return nil, err
+	}
+	cache := c.metadataCache()
+	if cache == nil {
+		return c.downloadIndexFile(source, release, u, name, sum)
+	}
+	if f, ok := cache.openVerified(u, sum); ok {
+		return f, nil
+	}
+	body, err := c.downloadIndexFile(source, release, u, name, sum)
+	if err != nil {
+		return nil, err
+	}
+	return cache.tee(u, body, sum), nil
+}
+
+// downloadIndexFile retrieves the file name, whose canonical URL is u, from
+// the repository.
+func (c *Client) downloadIndexFile(source *Source, release *Release, u, name string, sum fileChecksum) (io.ReadCloser, error) {
+	if release.AcquireByHash {
+		byHashURL, err := source.ByHashURL(name, sum.Hash, sum.Sum)
+		if err != nil {
+			return nil, err
+		}
+		body, err := c.open(byHashURL)
+		if err != FileNotFound {
+			return body, err
+		}
+	}
+	return c.open(u)
+}
+
+// byHashPath returns the by-hash location of the file name with checksum sum.
+func byHashPath(name string, sum fileChecksum) string {
+	return path.Join(path.Dir(name), "by-hash", byHashDirs[sum.Hash], hex.EncodeToString(sum.Sum))
+}
+
+// byHashDirs maps hash functions to the by-hash directory of their checksums.
+var byHashDirs = map[crypto.Hash]string{
+	crypto.MD5:    "MD5Sum",
+	crypto.SHA1:   "SHA1",
+	crypto.SHA256: "SHA256",
+	crypto.SHA512: "SHA512",
+}
+
+// newIndexReader returns a ReadCloser decompressing body and verifying it
+// against sum and, if it is not nil, the decompressed data against
+// uncompressed.
+func newIndexReader(body io.ReadCloser, comp compression, sum fileChecksum, uncompressed *fileChecksum) (io.ReadCloser, error) {
+	compressed := newVerifyingReader(body, sum)
+	dr, err := comp.newReader(compressed)
+	if err != nil {
+		body.Close()
+		return nil, err
+	}
+	ir := &indexReader{r: dr, compressed: compressed, closers: []io.Closer{dr, body}}
+	if uncompressed != nil {
+		ir.r = newVerifyingReader(dr, *uncompressed)
+	}
+	return ir, nil
+}
+
+type indexReader struct {
+	r          io.Reader
+	compressed *verifyingReader
+	closers    []io.Closer
+}
+
+func (ir *indexReader) Read(p []byte) (int, error) {
+	n, err := ir.r.Read(p)
+	if err == io.EOF && ir.compressed != nil {
+		// Decompressors may stop before the end of the compressed stream.
+		// Drain it so its checksum is verified.
+		if _, derr := io.Copy(ioutil.Discard, ir.compressed); derr != nil {
+			return n, derr
+		}
+	}
+	return n, err
+}
+
+func (ir *indexReader) Close() error {
+	var err error
+	for _, c := range ir.closers {
+		if cerr := c.Close(); err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+// verifyingReader checks the data read from r against a Release checksum.
+type verifyingReader struct {
+	r   io.Reader
+	sum fileChecksum
+	h   hash.Hash
+	n   int64
+}
+
+func newVerifyingReader(r io.Reader, sum fileChecksum) *verifyingReader {
+	return &verifyingReader{r: r, sum: sum, h: sum.Hash.New()}
+}
+
+func (vr *verifyingReader) Read(p []byte) (int, error) {
+	n, err := vr.r.Read(p)
+	vr.h.Write(p[:n])
+	vr.n += int64(n)
+	if vr.n > vr.sum.Length {
+		return n, HashMismatch
+	}
+	if err == io.EOF {
+		if vr.n != vr.sum.Length || !bytes.Equal(vr.h.Sum(nil), vr.sum.Sum) {
+			return n, HashMismatch
+		}
+	}
+	return n, err
+}
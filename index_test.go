@@ -0,0 +1,291 @@
+package debrepo
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/ulikunitz/xz"
+	"github.com/ulikunitz/xz/lzma"
+)
+
+// testRepo is an in-memory repository serving the files of a single
+// distribution.
+type testRepo struct {
+	*httptest.Server
+	mu        sync.Mutex
+	files     map[string][]byte
+	requested []string
+}
+
+// newTestRepo returns a testRepo serving files below
+// "/debian/dists/jessie". File names are relative to that directory.
+func newTestRepo(files map[string][]byte) *testRepo {
+	tr := &testRepo{files: files}
+	tr.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tr.mu.Lock()
+		tr.requested = append(tr.requested, r.URL.Path)
+		b, ok := tr.files[strings.TrimPrefix(r.URL.Path, "/debian/dists/jessie/")]
+		tr.mu.Unlock()
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write(b)
+	}))
+	return tr
+}
+
+// Requested returns the base names of the requested files.
+func (tr *testRepo) Requested() []string {
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+	names := make([]string, 0, len(tr.requested))
+	for _, r := range tr.requested {
+		names = append(names, path.Base(r))
+	}
+	return names
+}
+
+// testRelease returns a Release listing the SHA256 checksums of files.
+func testRelease(files map[string][]byte) *Release {
+	r := &Release{SHA256: make(map[string]SHA256FileMetaData)}
+	for name, b := range files {
+		r.SHA256[name] = SHA256FileMetaData{Length: int64(len(b)), Sum: sha256.Sum256(b)}
+	}
+	return r
+}
+
+func compressTestData(t *testing.T, ext string, b []byte) []byte {
+	buf := &bytes.Buffer{}
+	var w io.WriteCloser
+	var err error
+	switch ext {
+	case ".gz":
+		w = gzip.NewWriter(buf)
+	case ".xz":
+		w, err = xz.NewWriter(buf)
+	case ".lzma":
+		w, err = lzma.NewWriter(buf)
+	case ".zst":
+		w, err = zstd.NewWriter(buf)
+	default:
+		t.Fatalf("unsupported compression %s", ext)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Write(b); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func readTestPackages(t *testing.T) []byte {
+	b, err := ioutil.ReadFile("testdata/packages/Packages")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+const testPackagesPath = "main/binary-amd64/Packages"
+
+func fetchTestIndex(t *testing.T, tr *testRepo, release *Release) ([]byte, error) {
+	source := newTestSource(t, tr.URL+"/debian")
+	c := NewClient(SourceList{source}, nil, nil)
+	rc, err := c.FetchIndex(source, release, testPackagesPath)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	return ioutil.ReadAll(rc)
+}
+
+func TestClient_FetchIndex_Compressions(t *testing.T) {
+	packages := readTestPackages(t)
+	for _, ext := range []string{"", ".gz", ".xz", ".lzma", ".zst"} {
+		files := map[string][]byte{testPackagesPath: packages}
+		if ext != "" {
+			files = map[string][]byte{testPackagesPath + ext: compressTestData(t, ext, packages)}
+		}
+		tr := newTestRepo(files)
+		b, err := fetchTestIndex(t, tr, testRelease(files))
+		tr.Close()
+		if err != nil {
+			t.Fatalf("%s: %v", ext, err)
+		}
+		if !bytes.Equal(packages, b) {
+			t.Fatalf("%s: content mismatch", ext)
+		}
+	}
+}
+
+func TestClient_FetchIndex_PrefersBestCompression(t *testing.T) {
+	packages := readTestPackages(t)
+	files := map[string][]byte{
+		testPackagesPath:          packages,
+		testPackagesPath + ".gz":  compressTestData(t, ".gz", packages),
+		testPackagesPath + ".xz":  compressTestData(t, ".xz", packages),
+		testPackagesPath + ".zst": compressTestData(t, ".zst", packages),
+	}
+	tr := newTestRepo(files)
+	defer tr.Close()
+	if _, err := fetchTestIndex(t, tr, testRelease(files)); err != nil {
+		t.Fatal(err)
+	}
+	if expected, actual := []string{"Packages.xz"}, tr.Requested(); !reflect.DeepEqual(expected, actual) {
+		t.Fatalf("expected=%v actual=%v", expected, actual)
+	}
+}
+
+func TestClient_FetchIndex_FallsBackWhenMissing(t *testing.T) {
+	packages := readTestPackages(t)
+	files := map[string][]byte{
+		testPackagesPath:         packages,
+		testPackagesPath + ".gz": compressTestData(t, ".gz", packages),
+		testPackagesPath + ".xz": compressTestData(t, ".xz", packages),
+	}
+	release := testRelease(files)
+	delete(files, testPackagesPath+".xz")
+	tr := newTestRepo(files)
+	defer tr.Close()
+	b, err := fetchTestIndex(t, tr, release)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(packages, b) {
+		t.Fatal("content mismatch")
+	}
+	if expected, actual := []string{"Packages.xz", "Packages.gz"}, tr.Requested(); !reflect.DeepEqual(expected, actual) {
+		t.Fatalf("expected=%v actual=%v", expected, actual)
+	}
+}
+
+func TestClient_FetchIndex_HashMismatch(t *testing.T) {
+	packages := readTestPackages(t)
+	compressed := compressTestData(t, ".xz", packages)
+	tests := []struct {
+		release map[string][]byte
+		served  map[string][]byte
+	}{
+		// compressed file modified on the server
+		{
+			release: map[string][]byte{testPackagesPath + ".xz": compressed},
+			served:  map[string][]byte{testPackagesPath + ".xz": compressTestData(t, ".xz", packages[1:])},
+		},
+		// uncompressed checksum does not match
+		{
+			release: map[string][]byte{testPackagesPath + ".xz": compressed, testPackagesPath: packages[1:]},
+			served:  map[string][]byte{testPackagesPath + ".xz": compressed},
+		},
+		// trailing data after the compressed stream
+		{
+			release: map[string][]byte{testPackagesPath + ".xz": compressed},
+			served:  map[string][]byte{testPackagesPath + ".xz": append(append([]byte{}, compressed...), 0)},
+		},
+	}
+	for i, tt := range tests {
+		tr := newTestRepo(tt.served)
+		_, err := fetchTestIndex(t, tr, testRelease(tt.release))
+		tr.Close()
+		if expected, actual := HashMismatch, err; expected != actual {
+			t.Fatalf("test(%v): expected=%v actual=%v", i, expected, actual)
+		}
+	}
+}
+
+func TestClient_FetchIndex_NotListed(t *testing.T) {
+	tr := newTestRepo(nil)
+	defer tr.Close()
+	_, err := fetchTestIndex(t, tr, testRelease(map[string][]byte{"main/binary-i386/Packages": nil}))
+	if expected, actual := FileNotInRelease, err; expected != actual {
+		t.Fatalf("expected=%v actual=%v", expected, actual)
+	}
+	_, err = fetchTestIndex(t, tr, testRelease(map[string][]byte{testPackagesPath: nil}))
+	if expected, actual := FileNotFound, err; expected != actual {
+		t.Fatalf("expected=%v actual=%v", expected, actual)
+	}
+}
+
+func TestClient_FetchIndex_AcquireByHash(t *testing.T) {
+	packages := readTestPackages(t)
+	compressed := compressTestData(t, ".xz", packages)
+	release := testRelease(map[string][]byte{testPackagesPath + ".xz": compressed})
+	release.AcquireByHash = true
+	sum := sha256.Sum256(compressed)
+	byHash := "main/binary-amd64/by-hash/SHA256/" + hex.EncodeToString(sum[:])
+
+	tests := []struct {
+		served    map[string][]byte
+		requested []string
+	}{
+		{
+			served:    map[string][]byte{byHash: compressed, testPackagesPath + ".xz": []byte("stale")},
+			requested: []string{hex.EncodeToString(sum[:])},
+		},
+		{
+			served:    map[string][]byte{testPackagesPath + ".xz": compressed},
+			requested: []string{hex.EncodeToString(sum[:]), "Packages.xz"},
+		},
+	}
+	for i, tt := range tests {
+		tr := newTestRepo(tt.served)
+		b, err := fetchTestIndex(t, tr, release)
+		tr.Close()
+		if err != nil {
+			t.Fatalf("test(%v): %v", i, err)
+		}
+		if !bytes.Equal(packages, b) {
+			t.Fatalf("test(%v): content mismatch", i)
+		}
+		if expected, actual := tt.requested, tr.Requested(); !reflect.DeepEqual(expected, actual) {
+			t.Fatalf("test(%v): expected=%v actual=%v", i, expected, actual)
+		}
+	}
+}
+
+func TestClient_FetchIndex_SHA512(t *testing.T) {
+	packages := readTestPackages(t)
+	compressed := compressTestData(t, ".gz", packages)
+	release := testRelease(map[string][]byte{testPackagesPath + ".gz": compressed})
+	sum := sha512.Sum512(compressed)
+	release.SHA512 = map[string]SHA512FileMetaData{
+		testPackagesPath + ".gz": {Length: int64(len(compressed)), Sum: sum},
+	}
+	release.AcquireByHash = true
+	byHash := "main/binary-amd64/by-hash/SHA512/" + hex.EncodeToString(sum[:])
+
+	tr := newTestRepo(map[string][]byte{byHash: compressed})
+	defer tr.Close()
+	b, err := fetchTestIndex(t, tr, release)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(packages, b) {
+		t.Fatal("content mismatch")
+	}
+
+	// The SHA512 checksum is verified even if the SHA256 checksum matches.
+	release.SHA512[testPackagesPath+".gz"] = SHA512FileMetaData{Length: int64(len(compressed))}
+	tr2 := newTestRepo(map[string][]byte{testPackagesPath + ".gz": compressed})
+	defer tr2.Close()
+	if _, err := fetchTestIndex(t, tr2, release); err != HashMismatch {
+		t.Fatalf("expected=%v actual=%v", HashMismatch, err)
+	}
+}
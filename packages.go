@@ -0,0 +1,74 @@
+package debrepo
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"strings"
+)
+
+// A Package is an entry in a binary package index. It is decoded from the
+// Packages file present at "dists/$DIST/$COMP/binary-$ARCH/Packages".
+// See https://wiki.debian.org/DebianRepository/Format#A.22Packages.22_Indices
+//
+// Multiline values, such as the extended Description, are stored with lines
+// separated by "\n" and without the leading space of continuation lines.
+type Package struct {
+	Package      string
+	Source       string
+	Version      string
+	Architecture string
+	Maintainer   string
+	// InstalledSize is the estimated installed size in kibibytes.
+	InstalledSize int64
+	Section       string
+	Priority      string
+	Essential     bool
+	MultiArch     string
+	Homepage      string
+	Tag           string
+
+	// Relationship fields to other packages.
+	Depends    string
+	PreDepends string
+	Recommends string
+	Suggests   string
+	Enhances   string
+	Breaks     string
+	Conflicts  string
+	Replaces   string
+	Provides   string
+	BuiltUsing string
+
+	Description    string
+	DescriptionMD5 string
+
+	// These fields locate the package archive in the repository pool and are
+	// used to verify it once downloaded.
+	Filename string
+	Size     int64
+	MD5Sum   [md5.Size]byte
+	SHA1     [sha1.Size]byte
+	SHA256   [sha256.Size]byte
+
+	// Extra contains the fields of the entry which are not represented
+	// above, keyed by field name.
+	Extra map[string]string
+}
+
+// SourceNameVersion returns the name and version of the source package p was
+// built from. The Source field is omitted when they are the same as those of
+// the binary package, and its version is omitted when it matches the version
+// of the binary package.
+func (p *Package) SourceNameVersion() (name, version string) {
+	name, version = p.Source, p.Version
+	if i := strings.Index(name, "("); i != -1 {
+		version = strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(name[i+1:]), ")"))
+		name = name[:i]
+	}
+	name = strings.TrimSpace(name)
+	if len(name) == 0 {
+		name = p.Package
+	}
+	return name, version
+}
@@ -0,0 +1,155 @@
+package debrepo
+
+import (
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+const (
+	// InvalidPackageEntry is returned on malformed Packages entries.
+	InvalidPackageEntry = Error("unable to parse package entry")
+)
+
+// A PackageReader reads Package entries from a Packages index.
+type PackageReader struct {
+	pr *ParagraphReader
+}
+
+// NewPackageReader returns a PackageReader reading from r. The index is read
+// one entry at a time, so r may be the uncompressed stream of a large
+// Packages file.
+func NewPackageReader(r io.Reader) *PackageReader {
+	return &PackageReader{pr: NewParagraphReader(r)}
+}
+
+// Read returns the next Package in the index. io.EOF is returned when there
+// are no more entries.
+func (pr *PackageReader) Read() (*Package, error) {
+	paragraph, err := pr.pr.Read()
+	if err != nil {
+		return nil, err
+	}
+	return parsePackage(paragraph)
+}
+
+// ReadPackages returns all Package entries of a Packages index.
+func ReadPackages(r io.Reader) ([]*Package, error) {
+	var packages []*Package
+	pr := NewPackageReader(r)
+	for {
+		p, err := pr.Read()
+		if err == io.EOF {
+			return packages, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		packages = append(packages, p)
+	}
+}
+
+func parsePackage(paragraph Paragraph) (*Package, error) {
+	p := &Package{}
+	var err error
+	for _, f := range paragraph {
+		switch strings.ToLower(f.Name) {
+		case "package":
+			p.Package = f.Value
+		case "source":
+			p.Source = f.Value
+		case "version":
+			p.Version = f.Value
+		case "architecture":
+			p.Architecture = f.Value
+		case "maintainer":
+			p.Maintainer = f.Value
+		case "installed-size":
+			p.InstalledSize, err = strconv.ParseInt(f.Value, 10, 64)
+		case "section":
+			p.Section = f.Value
+		case "priority":
+			p.Priority = f.Value
+		case "essential":
+			p.Essential, err = parseBool(f.Name, f.Value)
+		case "multi-arch":
+			p.MultiArch = f.Value
+		case "homepage":
+			p.Homepage = f.Value
+		case "tag":
+			p.Tag = f.Value
+		case "depends":
+			p.Depends = f.Value
+		case "pre-depends":
+			p.PreDepends = f.Value
+		case "recommends":
+			p.Recommends = f.Value
+		case "suggests":
+			p.Suggests = f.Value
+		case "enhances":
+			p.Enhances = f.Value
+		case "breaks":
+			p.Breaks = f.Value
+		case "conflicts":
+			p.Conflicts = f.Value
+		case "replaces":
+			p.Replaces = f.Value
+		case "provides":
+			p.Provides = f.Value
+		case "built-using":
+			p.BuiltUsing = f.Value
+		case "description":
+			p.Description = f.Value
+		case "description-md5":
+			p.DescriptionMD5 = f.Value
+		case "filename":
+			p.Filename = f.Value
+		case "size":
+			p.Size, err = strconv.ParseInt(f.Value, 10, 64)
+		case "md5sum":
+			err = decodeHexSum(p.MD5Sum[:], f.Value)
+		case "sha1":
+			err = decodeHexSum(p.SHA1[:], f.Value)
+		case "sha256":
+			err = decodeHexSum(p.SHA256[:], f.Value)
+		default:
+			if p.Extra == nil {
+				p.Extra = make(map[string]string)
+			}
+			p.Extra[f.Name] = f.Value
+		}
+		if err != nil {
+			return nil, fmt.Errorf("package %s: field %s: %v", p.Package, f.Name, err)
+		}
+	}
+	if len(p.Package) == 0 {
+		return nil, InvalidPackageEntry
+	}
+	return p, nil
+}
+
+// decodeHexSum decodes the hex encoded checksum s into dst. The length of s
+// must match dst.
+func decodeHexSum(dst []byte, s string) error {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		return err
+	}
+	if len(b) != len(dst) {
+		return fmt.Errorf("invalid checksum length %d", len(b))
+	}
+	copy(dst, b)
+	return nil
+}
+
+func parseBool(field, value string) (bool, error) {
+	switch value {
+	case "yes":
+		return true, nil
+	case "no":
+		return false, nil
+	}
+	return false, fmt.Errorf("invalid value for %s", field)
+}
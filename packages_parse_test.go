@@ -0,0 +1,93 @@
+package debrepo
+
+import (
+	"encoding/hex"
+	"io"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestPackageReader_Read(t *testing.T) {
+	f, err := os.Open("testdata/packages/Packages")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	pr := NewPackageReader(f)
+	var packages []*Package
+	for {
+		p, err := pr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		packages = append(packages, p)
+	}
+	if expected, actual := 3, len(packages); expected != actual {
+		t.Fatalf("expected=%v actual=%v", expected, actual)
+	}
+
+	bash := packages[1]
+	checkField := func(field, expected, actual string) {
+		if expected != actual {
+			t.Fatalf("%s: expected=%q actual=%q", field, expected, actual)
+		}
+	}
+	checkField("Package", "bash", bash.Package)
+	checkField("Version", "4.3-11+b1", bash.Version)
+	checkField("Source", "bash (4.3-11)", bash.Source)
+	checkField("Architecture", "amd64", bash.Architecture)
+	checkField("MultiArch", "foreign", bash.MultiArch)
+	checkField("PreDepends", "dash (>= 0.5.5.1-2.2), libc6 (>= 2.14), libtinfo5", bash.PreDepends)
+	checkField("Filename", "pool/main/b/bash/bash_4.3-11+b1_amd64.deb", bash.Filename)
+	checkField("SHA256", "5fd2a67ac0a5b8bb34f68d2ea7d4bb91a1d3e5e1c4b4b2f3a0a6d7e8f9c0b1a2", hex.EncodeToString(bash.SHA256[:]))
+	if !bash.Essential {
+		t.Fatal("expected bash to be essential")
+	}
+	if expected, actual := int64(1467142), bash.Size; expected != actual {
+		t.Fatalf("Size: expected=%v actual=%v", expected, actual)
+	}
+	if expected, actual := int64(5132), bash.InstalledSize; expected != actual {
+		t.Fatalf("InstalledSize: expected=%v actual=%v", expected, actual)
+	}
+	lines := strings.Split(bash.Description, "\n")
+	if expected, actual := 6, len(lines); expected != actual {
+		t.Fatalf("Description lines: expected=%v actual=%v", expected, actual)
+	}
+	checkField("Description", "GNU Bourne Again SHell", lines[0])
+	checkField("Description", ".", lines[3])
+
+	libc := packages[2]
+	checkField("Extra", "x-custom-field", libc.Extra["Ruleset"])
+	checkField("Tag", "role::shared-lib", libc.Tag)
+	checkField("Tag", "game::strategy, interface::graphical, interface::x11, role::program,\nuitoolkit::sdl, uitoolkit::wxwidgets, use::gameplaying,\nx11::application", packages[0].Tag)
+}
+
+func TestReadPackages_Invalid(t *testing.T) {
+	tests := []string{
+		" continuation without field",
+		"Package bash",
+		"Version: 1.0",
+		"Package: bash\nSize: large",
+		"Package: bash\nEssential: maybe",
+		"Package: bash\nSHA256: 0123",
+	}
+	for i, tt := range tests {
+		if _, err := ReadPackages(strings.NewReader(tt)); err == nil {
+			t.Fatalf("test(%v): expected error", i)
+		}
+	}
+}
+
+func TestReadPackages_Empty(t *testing.T) {
+	packages, err := ReadPackages(strings.NewReader("\n\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected, actual := 0, len(packages); expected != actual {
+		t.Fatalf("expected=%v actual=%v", expected, actual)
+	}
+}
@@ -0,0 +1,432 @@
+package debrepo
+
+import (
+	"bufio"
+	"bytes"
+	"crypto"
+	"io"
+	"io/ioutil"
+	"path"
+	"strconv"
+	"strings"
+)
+
+const (
+	// InvalidPDiffIndex is returned when a "Index" file of patches to an index
+	// file is malformed.
+	InvalidPDiffIndex = Error("unable to parse pdiff index")
+
+	// InvalidPatch is returned when an ed style patch is malformed or does not
+	// apply to the file being patched.
+	InvalidPatch = Error("unable to apply patch")
+
+	// UnsupportedPatchCompression is returned when a "Index" file of patches
+	// lists a patch only in compression formats which are not supported.
+	UnsupportedPatchCompression = Error("patch compression not supported")
+)
+
+// A PDiffIndex lists the patches which update an index file, such as
+// "main/binary-amd64/Packages", from previous versions to its current
+// version. It is read from the file "$INDEX.diff/Index".
+// See https://wiki.debian.org/DebianRepository/Format#Diffs
+type PDiffIndex struct {
+	// Current is the checksum of the current version of the index file.
+	Current PDiffFile
+	// History lists the checksums of previous versions of the index file,
+	// from oldest to newest. Each entry is named after the patch which
+	// updates that version.
+	History []PDiffFile
+	// Patches lists the checksums of the uncompressed patches.
+	Patches []PDiffFile
+	// Download lists the checksums of the compressed patches, which are the
+	// files retrieved from the repository.
+	Download []PDiffFile
+	// Merged is set when each patch updates its version of the index file
+	// directly to the current version, rather than to the next version.
+	Merged bool
+}
+
+// A PDiffFile is a checksum entry of a PDiffIndex.
+type PDiffFile struct {
+	Name   string
+	Hash   crypto.Hash
+	Sum    []byte
+	Length int64
+}
+
+func (f PDiffFile) checksum() fileChecksum {
+	return fileChecksum{Hash: f.Hash, Sum: f.Sum, Length: f.Length}
+}
+
+// pdiffHashes lists the checksum field prefixes of a PDiffIndex in order of
+// preference.
+var pdiffHashes = []struct {
+	prefix string
+	hash   crypto.Hash
+}{
+	{"SHA256", crypto.SHA256},
+	{"SHA1", crypto.SHA1},
+}
+
+// ReadPDiffIndex returns a PDiffIndex from a "Index" file. The strongest
+// checksums present in the file are used.
+func ReadPDiffIndex(r io.Reader) (*PDiffIndex, error) {
+	p, err := NewParagraphReader(r).Read()
+	if err == io.EOF {
+		return nil, InvalidPDiffIndex
+	}
+	if err != nil {
+		return nil, err
+	}
+	for _, h := range pdiffHashes {
+		current, ok := p.Lookup(h.prefix + "-Current")
+		if !ok {
+			continue
+		}
+		index := &PDiffIndex{Merged: p.Get("X-Patch-Precedence") == "merged"}
+		words := strings.Fields(current)
+		if len(words) != 2 {
+			return nil, InvalidPDiffIndex
+		}
+		if index.Current, err = parsePDiffFile(h.hash, words[0], words[1], ""); err != nil {
+			return nil, err
+		}
+		if index.History, err = parsePDiffFiles(h.hash, p.Get(h.prefix+"-History")); err != nil {
+			return nil, err
+		}
+		if index.Patches, err = parsePDiffFiles(h.hash, p.Get(h.prefix+"-Patches")); err != nil {
+			return nil, err
+		}
+		if index.Download, err = parsePDiffFiles(h.hash, p.Get(h.prefix+"-Download")); err != nil {
+			return nil, err
+		}
+		return index, nil
+	}
+	return nil, InvalidPDiffIndex
+}
+
+func parsePDiffFiles(h crypto.Hash, value string) ([]PDiffFile, error) {
+	var files []PDiffFile
+	for _, line := range fileSumLines(value) {
+		words := strings.Fields(line)
+		if len(words) != 3 {
+			return nil, InvalidPDiffIndex
+		}
+		f, err := parsePDiffFile(h, words[0], words[1], words[2])
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, f)
+	}
+	return files, nil
+}
+
+func parsePDiffFile(h crypto.Hash, sum, length, name string) (PDiffFile, error) {
+	f := PDiffFile{Name: name, Hash: h, Sum: make([]byte, h.Size())}
+	if err := decodeHexSum(f.Sum, sum); err != nil {
+		return PDiffFile{}, InvalidPDiffIndex
+	}
+	var err error
+	if f.Length, err = strconv.ParseInt(length, 10, 64); err != nil {
+		return PDiffFile{}, InvalidPDiffIndex
+	}
+	return f, nil
+}
+
+func findPDiffFile(files []PDiffFile, name string) (PDiffFile, bool) {
+	for _, f := range files {
+		if f.Name == name {
+			return f, true
+		}
+	}
+	return PDiffFile{}, false
+}
+
+// patchesFrom returns the names of the patches which update the version of the
+// index file with the checksum sum to the current version. It returns false
+// if the version is not in the history.
+func (index *PDiffIndex) patchesFrom(sum []byte) ([]string, bool) {
+	for i, f := range index.History {
+		if !bytes.Equal(f.Sum, sum) {
+			continue
+		}
+		if index.Merged {
+			return []string{f.Name}, true
+		}
+		var names []string
+		for _, f := range index.History[i:] {
+			names = append(names, f.Name)
+		}
+		return names, true
+	}
+	return nil, false
+}
+
+// ApplyEdPatch applies the ed style patch read from patch, as produced by
+// "diff --ed", to the file read from r and writes the result to w. The
+// commands "a", "c", "d", "i" and "s/.//" are supported. Commands without an
+// address apply to the current line, which diff relies on to continue text
+// after a line consisting of a single ".".
+func ApplyEdPatch(w io.Writer, r io.Reader, patch io.Reader) error {
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	var lines [][]byte
+	if len(b) > 0 {
+		lines = bytes.Split(bytes.TrimSuffix(b, []byte("\n")), []byte("\n"))
+	}
+
+	scanner := bufio.NewScanner(patch)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxLineLength)
+	current := 0
+	for scanner.Scan() {
+		cmd := scanner.Text()
+		switch cmd {
+		case "":
+			continue
+		case "w", "q":
+			continue
+		case "s/.//":
+			if current < 1 || current > len(lines) || !bytes.HasPrefix(lines[current-1], []byte(".")) {
+				return InvalidPatch
+			}
+			lines[current-1] = lines[current-1][1:]
+			continue
+		}
+		start, end := current, current
+		if addr := cmd[:len(cmd)-1]; addr != "" {
+			if start, end, err = parseEdRange(addr); err != nil {
+				return err
+			}
+		}
+		var text [][]byte
+		op := cmd[len(cmd)-1]
+		if op == 'a' || op == 'c' || op == 'i' {
+			if text, err = readEdText(scanner); err != nil {
+				return err
+			}
+		}
+		switch op {
+		case 'a':
+			if start != end || start > len(lines) {
+				return InvalidPatch
+			}
+			lines = spliceLines(lines, start, start, text)
+			current = start + len(text)
+		case 'i':
+			if start != end || start > len(lines) {
+				return InvalidPatch
+			}
+			if start > 0 {
+				start--
+			}
+			lines = spliceLines(lines, start, start, text)
+			current = start + len(text)
+		case 'c', 'd':
+			if start < 1 || end > len(lines) {
+				return InvalidPatch
+			}
+			lines = spliceLines(lines, start-1, end, text)
+			current = start - 1 + len(text)
+		default:
+			return InvalidPatch
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	bw := bufio.NewWriter(w)
+	for _, line := range lines {
+		if _, err := bw.Write(line); err != nil {
+			return err
+		}
+		if err := bw.WriteByte('\n'); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
+
+// parseEdRange parses the address "N" or "N,M" of an ed command.
+func parseEdRange(addr string) (start, end int, err error) {
+	first, last := addr, addr
+	if i := strings.Index(addr, ","); i != -1 {
+		first, last = addr[:i], addr[i+1:]
+	}
+	if start, err = strconv.Atoi(first); err != nil || start < 0 {
+		return 0, 0, InvalidPatch
+	}
+	if end, err = strconv.Atoi(last); err != nil || end < start {
+		return 0, 0, InvalidPatch
+	}
+	return start, end, nil
+}
+
+// readEdText reads the text of an "a", "c" or "i" command, which is
+// terminated by a line containing a single ".".
+func readEdText(scanner *bufio.Scanner) ([][]byte, error) {
+	var text [][]byte
+	for scanner.Scan() {
+		if scanner.Text() == "." {
+			return text, nil
+		}
+		text = append(text, append([]byte(nil), scanner.Bytes()...))
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return nil, InvalidPatch
+}
+
+// spliceLines replaces lines[i:j] with text.
+func spliceLines(lines [][]byte, i, j int, text [][]byte) [][]byte {
+	result := make([][]byte, 0, len(lines)-(j-i)+len(text))
+	result = append(result, lines[:i]...)
+	result = append(result, text...)
+	return append(result, lines[j:]...)
+}
+
+// UpdateIndex returns the current contents of the uncompressed index file
+// name of the distribution referenced by source, given the contents old of a
+// previously retrieved version. release must be the verified Release of the
+// distribution.
+//
+// If the repository publishes patches for the index file in
+// "$INDEX.diff/Index" and old is a version listed in its history, only the
+// patches needed to update old are downloaded and applied. The result is
+// verified against the checksum of the current version. Otherwise, or if
+// patching fails, the complete index file is downloaded using FetchIndex.
+func (c *Client) UpdateIndex(source *Source, release *Release, name string, old []byte) ([]byte, error) {
+	if b, err := c.patchIndex(source, release, name, old); err == nil {
+		return b, nil
+	}
+	rc, err := c.FetchIndex(source, release, name)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	return ioutil.ReadAll(rc)
+}
+
+// patchIndex updates old to the current version of the index file name using
+// the patches published by the repository.
+func (c *Client) patchIndex(source *Source, release *Release, name string, old []byte) ([]byte, error) {
+	rc, err := c.FetchIndex(source, release, name+".diff/Index")
+	if err != nil {
+		return nil, err
+	}
+	index, err := ReadPDiffIndex(rc)
+	rc.Close()
+	if err != nil {
+		return nil, err
+	}
+	if !c.hashPolicy().accepts(index.Current.Hash) {
+		return nil, InsufficientHashes
+	}
+
+	if checkSum(old, index.Current.checksum()) == nil {
+		return old, nil
+	}
+	h := index.Current.Hash.New()
+	h.Write(old)
+	patches, ok := index.patchesFrom(h.Sum(nil))
+	if !ok {
+		return nil, FileNotFound
+	}
+
+	b := old
+	for _, patch := range patches {
+		rc, err := c.openPatch(source, index, name, patch)
+		if err != nil {
+			return nil, err
+		}
+		buf := &bytes.Buffer{}
+		err = ApplyEdPatch(buf, bytes.NewReader(b), rc)
+		rc.Close()
+		if err != nil {
+			return nil, err
+		}
+		b = buf.Bytes()
+	}
+
+	if err := checkSum(b, index.Current.checksum()); err != nil {
+		return nil, err
+	}
+	if sum, ok := c.checksum(release, name); ok {
+		if err := checkSum(b, sum); err != nil {
+			return nil, err
+		}
+	}
+	return b, nil
+}
+
+// openPatch downloads the patch named patch of the index file name and
+// returns its decompressed contents, which are verified against the
+// checksums of index.
+func (c *Client) openPatch(source *Source, index *PDiffIndex, name, patch string) (io.ReadCloser, error) {
+	uncompressed, ok := findPDiffFile(index.Patches, patch)
+	if !ok {
+		return nil, InvalidPDiffIndex
+	}
+	download, comp, err := findPatchDownload(index, patch)
+	if err != nil {
+		return nil, err
+	}
+	u, err := source.URL(path.Join(name+".diff", download.Name))
+	if err != nil {
+		return nil, err
+	}
+	body, err := c.open(u)
+	if err != nil {
+		return nil, err
+	}
+	sum := uncompressed.checksum()
+	if download.Sum == nil {
+		dr, err := comp.newReader(body)
+		if err != nil {
+			body.Close()
+			return nil, err
+		}
+		return &indexReader{r: newVerifyingReader(dr, sum), closers: []io.Closer{dr, body}}, nil
+	}
+	return newIndexReader(body, comp, download.checksum(), &sum)
+}
+
+// findPatchDownload returns the most preferred file of index.Download holding
+// patch and the compression of the file. A file named patch itself holds the
+// uncompressed patch.
+func findPatchDownload(index *PDiffIndex, patch string) (PDiffFile, compression, error) {
+	for _, comp := range compressions {
+		if download, ok := findPDiffFile(index.Download, patch+comp.ext); ok {
+			return download, comp, nil
+		}
+	}
+	if len(index.Download) > 0 {
+		for _, download := range index.Download {
+			if strings.HasPrefix(download.Name, patch+".") {
+				return PDiffFile{}, compression{}, UnsupportedPatchCompression
+			}
+		}
+		return PDiffFile{}, compression{}, InvalidPDiffIndex
+	}
+	// Repositories predating the Download field only publish gzip compressed
+	// patches and list no checksum for them.
+	for _, comp := range compressions {
+		if comp.ext == ".gz" {
+			return PDiffFile{Name: patch + comp.ext}, comp, nil
+		}
+	}
+	return PDiffFile{}, compression{}, UnsupportedPatchCompression
+}
+
+// checkSum returns HashMismatch if b does not match sum.
+func checkSum(b []byte, sum fileChecksum) error {
+	h := sum.Hash.New()
+	h.Write(b)
+	if int64(len(b)) != sum.Length || !bytes.Equal(h.Sum(nil), sum.Sum) {
+		return HashMismatch
+	}
+	return nil
+}
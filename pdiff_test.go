@@ -0,0 +1,230 @@
+package debrepo
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/sha256"
+	"fmt"
+	"io/ioutil"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestApplyEdPatch(t *testing.T) {
+	tests := []struct {
+		in, patch, out string
+		err            error
+	}{
+		{"a\nb\nc\n", "2d\n", "a\nc\n", nil},
+		{"a\nb\nc\n", "1,2d\n", "c\n", nil},
+		{"a\nb\nc\n", "2c\nx\ny\n.\n", "a\nx\ny\nc\n", nil},
+		{"a\nb\nc\n", "3a\nd\n.\n0a\nz\n.\n", "z\na\nb\nc\nd\n", nil},
+		// Output of "diff --ed", which continues text after a line
+		// consisting of a single "." with an address-less "a".
+		{"a\nb\nc\n", "3c\n..\n.\ns/.//\na\nd\n.\n", "a\nb\n.\nd\n", nil},
+		{"a\nb\nc\n", "1,3c\nx\n..\n.\ns/.//\na\ny\n.\n", "x\n.\ny\n", nil},
+		{"a\nb\nc\nd\n", "3c\n..\n.\ns/.//\na\n..\n.\n1c\n..\n.\ns/.//\n", ".\nb\n.\n..\nd\n", nil},
+		{"a\nb\nc\n", "2i\nx\n.\ni\ny\n.\nc\nz\n.\n", "a\nz\nx\nb\nc\n", nil},
+		{"a\nb\nc\n", "0i\nx\n.\n", "x\na\nb\nc\n", nil},
+		{"a\nb\nc\n", "3c\nx\n.\nw\n", "a\nb\nx\n", nil},
+		{"", "0a\na\n.\n", "a\n", nil},
+		{"a\nb\nc\n", "4d\n", "", InvalidPatch},
+		{"a\nb\nc\n", "2,1d\n", "", InvalidPatch},
+		{"a\nb\nc\n", "2x\n", "", InvalidPatch},
+		{"a\nb\nc\n", "2c\nx\n", "", InvalidPatch},
+		{"a\nb\nc\n", "s/.//\n", "", InvalidPatch},
+		{"a\nb\nc\n", "c\nx\n.\n", "", InvalidPatch},
+		{"a\nb\nc\n", "4i\nx\n.\n", "", InvalidPatch},
+	}
+	for i, tt := range tests {
+		buf := &bytes.Buffer{}
+		err := ApplyEdPatch(buf, strings.NewReader(tt.in), strings.NewReader(tt.patch))
+		if expected, actual := tt.err, err; expected != actual {
+			t.Fatalf("test(%v): error: expected=%v actual=%v", i, expected, actual)
+		}
+		if err != nil {
+			continue
+		}
+		if expected, actual := tt.out, buf.String(); expected != actual {
+			t.Fatalf("test(%v): expected=%q actual=%q", i, expected, actual)
+		}
+	}
+}
+
+func pdiffTestLine(b []byte, name string) string {
+	return fmt.Sprintf(" %x %d %s\n", sha256.Sum256(b), len(b), name)
+}
+
+func TestReadPDiffIndex(t *testing.T) {
+	index, err := ReadPDiffIndex(strings.NewReader("SHA1-Current: 0000000000000000000000000000000000000000 10\n" +
+		"SHA256-Current: " + strings.Repeat("ab", 32) + " 1234\n" +
+		"SHA256-History:\n" + pdiffTestLine([]byte("v1"), "T-1-F.1") +
+		"SHA256-Patches:\n" + pdiffTestLine([]byte("p1"), "T-1-F.1") +
+		"SHA256-Download:\n" + pdiffTestLine([]byte("d1"), "T-1-F.1.gz") +
+		"X-Patch-Precedence: merged\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected, actual := crypto.SHA256, index.Current.Hash; expected != actual {
+		t.Fatalf("expected=%v actual=%v", expected, actual)
+	}
+	if expected, actual := int64(1234), index.Current.Length; expected != actual {
+		t.Fatalf("expected=%v actual=%v", expected, actual)
+	}
+	sum := sha256.Sum256([]byte("v1"))
+	expected := []PDiffFile{{Name: "T-1-F.1", Hash: crypto.SHA256, Sum: sum[:], Length: 2}}
+	if actual := index.History; !reflect.DeepEqual(expected, actual) {
+		t.Fatalf("expected=%v actual=%v", expected, actual)
+	}
+	if expected, actual := "T-1-F.1.gz", index.Download[0].Name; expected != actual {
+		t.Fatalf("expected=%v actual=%v", expected, actual)
+	}
+	if !index.Merged {
+		t.Fatal("expected merged patches")
+	}
+
+	for i, tt := range []string{
+		"",
+		"MD5Sum-Current: 00000000000000000000000000000000 10\n",
+		"SHA256-Current: abcd 10\n",
+		"SHA256-Current: " + strings.Repeat("ab", 32) + " 10\nSHA256-History:\n abcd 1\n",
+	} {
+		if _, err := ReadPDiffIndex(strings.NewReader(tt)); err != InvalidPDiffIndex {
+			t.Fatalf("test(%v): expected=%v actual=%v", i, InvalidPDiffIndex, err)
+		}
+	}
+}
+
+// pdiffTestRepo returns the files of a repository publishing the test
+// Packages file and patches from two previous versions, along with those
+// versions. If patch2 is not nil, it replaces the patch from the second
+// version.
+func pdiffTestRepo(t *testing.T, merged bool, patch2 []byte) (files map[string][]byte, v1, v2 []byte) {
+	current := readTestPackages(t)
+	lines := strings.SplitAfter(string(current), "\n")
+	v2 = []byte("Package: old\n" + strings.Join(lines[1:], ""))
+	v1 = []byte("Package: old\n" + strings.Join(lines[1:3], "") + "X-Old: 1\nX-Old: 2\n" + strings.Join(lines[3:], ""))
+	patch1 := []byte("4,5d\n")
+	if patch2 == nil {
+		patch2 = []byte("1c\n" + lines[0] + ".\n")
+	}
+	if merged {
+		patch1 = []byte("4,5d\n1c\n" + lines[0] + ".\n")
+	}
+	gz1, gz2 := compressTestData(t, ".gz", patch1), compressTestData(t, ".gz", patch2)
+
+	index := fmt.Sprintf("SHA256-Current: %x %d\n", sha256.Sum256(current), len(current)) +
+		"SHA256-History:\n" + pdiffTestLine(v1, "T-1-F.1") + pdiffTestLine(v2, "T-2-F.1") +
+		"SHA256-Patches:\n" + pdiffTestLine(patch1, "T-1-F.1") + pdiffTestLine(patch2, "T-2-F.1") +
+		"SHA256-Download:\n" + pdiffTestLine(gz1, "T-1-F.1.gz") + pdiffTestLine(gz2, "T-2-F.1.gz")
+	if merged {
+		index += "X-Patch-Precedence: merged\n"
+	}
+	files = map[string][]byte{
+		testPackagesPath + ".gz":              compressTestData(t, ".gz", current),
+		testPackagesPath + ".diff/Index":      []byte(index),
+		testPackagesPath + ".diff/T-1-F.1.gz": gz1,
+		testPackagesPath + ".diff/T-2-F.1.gz": gz2,
+	}
+	return files, v1, v2
+}
+
+func TestClient_UpdateIndex(t *testing.T) {
+	current := readTestPackages(t)
+	for _, merged := range []bool{false, true} {
+		files, v1, v2 := pdiffTestRepo(t, merged, nil)
+		tests := []struct {
+			old       []byte
+			requested []string
+		}{
+			{current, []string{"Index"}},
+			{v2, []string{"Index", "T-2-F.1.gz"}},
+			{v1, []string{"Index", "T-1-F.1.gz", "T-2-F.1.gz"}},
+			{[]byte("Package: unknown\n"), []string{"Index", "Packages.gz"}},
+		}
+		if merged {
+			tests[2].requested = []string{"Index", "T-1-F.1.gz"}
+		}
+		for i, tt := range tests {
+			tr := newTestRepo(files)
+			source := newTestSource(t, tr.URL+"/debian")
+			c := NewClient(SourceList{source}, nil, nil)
+			b, err := c.UpdateIndex(source, testRelease(files), testPackagesPath, tt.old)
+			tr.Close()
+			if err != nil {
+				t.Fatalf("test(%v, merged=%v): %v", i, merged, err)
+			}
+			if !bytes.Equal(current, b) {
+				t.Fatalf("test(%v, merged=%v): content mismatch", i, merged)
+			}
+			if expected, actual := tt.requested, tr.Requested(); !reflect.DeepEqual(expected, actual) {
+				t.Fatalf("test(%v, merged=%v): expected=%v actual=%v", i, merged, expected, actual)
+			}
+		}
+	}
+}
+
+func TestClient_UpdateIndex_BadPatch(t *testing.T) {
+	current := readTestPackages(t)
+	// The patch applies but does not produce the current version.
+	files, _, v2 := pdiffTestRepo(t, false, []byte("2d\n"))
+
+	tr := newTestRepo(files)
+	defer tr.Close()
+	source := newTestSource(t, tr.URL+"/debian")
+	c := NewClient(SourceList{source}, nil, nil)
+	b, err := c.UpdateIndex(source, testRelease(files), testPackagesPath, v2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(current, b) {
+		t.Fatal("content mismatch")
+	}
+	if expected, actual := []string{"Index", "T-2-F.1.gz", "Packages.gz"}, tr.Requested(); !reflect.DeepEqual(expected, actual) {
+		t.Fatalf("expected=%v actual=%v", expected, actual)
+	}
+}
+
+func TestClient_openPatch(t *testing.T) {
+	patch := []byte("1d\n")
+	tests := []struct {
+		download string
+		b        []byte
+		err      error
+	}{
+		{"T-1-F.1.xz", compressTestData(t, ".xz", patch), nil},
+		{"T-1-F.1", patch, nil},
+		{"T-1-F.1.lz4", []byte("lz4"), UnsupportedPatchCompression},
+		{"T-2-F.1.gz", compressTestData(t, ".gz", patch), InvalidPDiffIndex},
+	}
+	for i, tt := range tests {
+		index, err := ReadPDiffIndex(strings.NewReader("SHA256-Current: " + strings.Repeat("ab", 32) + " 1234\n" +
+			"SHA256-Patches:\n" + pdiffTestLine(patch, "T-1-F.1") +
+			"SHA256-Download:\n" + pdiffTestLine(tt.b, tt.download)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		tr := newTestRepo(map[string][]byte{testPackagesPath + ".diff/" + tt.download: tt.b})
+		source := newTestSource(t, tr.URL+"/debian")
+		c := NewClient(SourceList{source}, nil, nil)
+		rc, err := c.openPatch(source, index, testPackagesPath, "T-1-F.1")
+		if expected, actual := tt.err, err; expected != actual {
+			tr.Close()
+			t.Fatalf("test(%v): error: expected=%v actual=%v", i, expected, actual)
+		}
+		if err != nil {
+			tr.Close()
+			continue
+		}
+		b, err := ioutil.ReadAll(rc)
+		rc.Close()
+		tr.Close()
+		if err != nil {
+			t.Fatalf("test(%v): %v", i, err)
+		}
+		if !bytes.Equal(patch, b) {
+			t.Fatalf("test(%v): expected=%q actual=%q", i, patch, b)
+		}
+	}
+}
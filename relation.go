@@ -0,0 +1,293 @@
+package debrepo
+
+import (
+	"strings"
+)
+
+const (
+	// InvalidRelation is returned on malformed package relationship fields.
+	InvalidRelation = Error("unable to parse package relationship")
+)
+
+// A Relation is a reference to a package in a relationship field such as
+// Depends, Pre-Depends, Recommends or Build-Depends.
+// See https://www.debian.org/doc/debian-policy/ch-relationships.html
+type Relation struct {
+	Name string
+	// ArchQualifier is the multiarch qualifier following the package name,
+	// such as "any" or "native" in "python3:any". It is empty if not set.
+	ArchQualifier string
+	// Operator is one of "<<", "<=", "=", ">=" or ">>". It is empty if the
+	// relation is not restricted to a version. The obsolete forms "<" and ">"
+	// are normalized to "<=" and ">=".
+	Operator string
+	Version  Version
+	// Architectures is the architecture restriction list, such as
+	// []string{"amd64", "!i386"} for "[amd64 !i386]".
+	Architectures []string
+	// Profiles are the build profile restriction formulas. Each element is one
+	// "<...>" group, such as []string{"!nocheck"} for "<!nocheck>".
+	Profiles [][]string
+}
+
+// Alternatives is a list of relations separated by "|". It is satisfied if
+// any one of the relations is satisfied.
+type Alternatives []Relation
+
+// Relations is the parsed value of a relationship field. It is a comma
+// separated list of Alternatives which must all be satisfied.
+type Relations []Alternatives
+
+// ParseRelations parses the value of a relationship field.
+func ParseRelations(s string) (Relations, error) {
+	var relations Relations
+	for _, group := range strings.Split(s, ",") {
+		if len(strings.TrimSpace(group)) == 0 {
+			continue
+		}
+		var alternatives Alternatives
+		for _, entry := range strings.Split(group, "|") {
+			r, err := parseRelation(entry)
+			if err != nil {
+				return nil, err
+			}
+			alternatives = append(alternatives, r)
+		}
+		relations = append(relations, alternatives)
+	}
+	return relations, nil
+}
+
+// parseRelation parses a single relation of the form:
+//
+//	name[:qualifier] [(op version)] [[arch ...]] [<profile ...>]...
+func parseRelation(s string) (Relation, error) {
+	var r Relation
+	s = strings.TrimSpace(s)
+	i := strings.IndexAny(s, " \t\n:([<")
+	if i == -1 {
+		i = len(s)
+	}
+	r.Name, s = s[:i], s[i:]
+	if !validPackageName(r.Name) {
+		return Relation{}, InvalidRelation
+	}
+	if strings.HasPrefix(s, ":") {
+		i = strings.IndexAny(s, " \t\n([<")
+		if i == -1 {
+			i = len(s)
+		}
+		r.ArchQualifier, s = s[1:i], s[i:]
+		if len(r.ArchQualifier) == 0 {
+			return Relation{}, InvalidRelation
+		}
+	}
+	s = strings.TrimSpace(s)
+	if strings.HasPrefix(s, "(") {
+		var constraint string
+		var ok bool
+		if constraint, s, ok = cutEnclosed(s, ')'); !ok {
+			return Relation{}, InvalidRelation
+		}
+		i = strings.IndexFunc(constraint, func(c rune) bool { return !strings.ContainsRune("<>=", c) })
+		if i <= 0 {
+			return Relation{}, InvalidRelation
+		}
+		switch r.Operator = constraint[:i]; r.Operator {
+		case "<<", "<=", "=", ">=", ">>":
+		case "<":
+			r.Operator = "<="
+		case ">":
+			r.Operator = ">="
+		default:
+			return Relation{}, InvalidRelation
+		}
+		v, err := ParseVersion(constraint[i:])
+		if err != nil {
+			return Relation{}, InvalidRelation
+		}
+		r.Version = v
+	}
+	if strings.HasPrefix(s, "[") {
+		var archs string
+		var ok bool
+		if archs, s, ok = cutEnclosed(s, ']'); !ok {
+			return Relation{}, InvalidRelation
+		}
+		if r.Architectures = strings.Fields(archs); len(r.Architectures) == 0 {
+			return Relation{}, InvalidRelation
+		}
+	}
+	for strings.HasPrefix(s, "<") {
+		var profiles string
+		var ok bool
+		if profiles, s, ok = cutEnclosed(s, '>'); !ok {
+			return Relation{}, InvalidRelation
+		}
+		terms := strings.Fields(profiles)
+		if len(terms) == 0 {
+			return Relation{}, InvalidRelation
+		}
+		r.Profiles = append(r.Profiles, terms)
+	}
+	if len(s) > 0 {
+		return Relation{}, InvalidRelation
+	}
+	return r, nil
+}
+
+// cutEnclosed returns the contents of s up to the closing character end,
+// excluding the opening character at s[0], and the trimmed remainder of s.
+func cutEnclosed(s string, end byte) (inside, rest string, ok bool) {
+	i := strings.IndexByte(s, end)
+	if i == -1 {
+		return "", "", false
+	}
+	return strings.TrimSpace(s[1:i]), strings.TrimSpace(s[i+1:]), true
+}
+
+// validPackageName reports whether name is a valid package name. Package
+// names consist of lower case letters, digits and the characters "+", "-" and
+// "." and must start with an alphanumeric character.
+func validPackageName(name string) bool {
+	if len(name) == 0 {
+		return false
+	}
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+		switch {
+		case isDigit(c), 'a' <= c && c <= 'z':
+		case i > 0 && strings.IndexByte("+-.", c) != -1:
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+func (r Relation) String() string {
+	s := r.Name
+	if len(r.ArchQualifier) > 0 {
+		s += ":" + r.ArchQualifier
+	}
+	if len(r.Operator) > 0 {
+		s += " (" + r.Operator + " " + r.Version.String() + ")"
+	}
+	if len(r.Architectures) > 0 {
+		s += " [" + strings.Join(r.Architectures, " ") + "]"
+	}
+	for _, p := range r.Profiles {
+		s += " <" + strings.Join(p, " ") + ">"
+	}
+	return s
+}
+
+func (a Alternatives) String() string {
+	ss := make([]string, 0, len(a))
+	for _, r := range a {
+		ss = append(ss, r.String())
+	}
+	return strings.Join(ss, " | ")
+}
+
+func (rs Relations) String() string {
+	ss := make([]string, 0, len(rs))
+	for _, a := range rs {
+		ss = append(ss, a.String())
+	}
+	return strings.Join(ss, ", ")
+}
+
+// SatisfiedByVersion reports whether v meets the version constraint of r. A
+// relation without a constraint is satisfied by any version.
+func (r Relation) SatisfiedByVersion(v Version) bool {
+	c := v.Compare(r.Version)
+	switch r.Operator {
+	case "":
+		return true
+	case "<<":
+		return c < 0
+	case "<=":
+		return c <= 0
+	case "=":
+		return c == 0
+	case ">=":
+		return c >= 0
+	case ">>":
+		return c > 0
+	}
+	return false
+}
+
+// Satisfies reports whether the relation r is satisfied by p, either
+// directly or through a package p provides. A versioned relation is only
+// satisfied through Provides if the provided package is versioned as well.
+//
+// The multiarch qualifier "any" requires p to be "Multi-Arch: allowed" and an
+// architecture qualifier requires p to be built for that architecture. The
+// qualifier "native" and the architecture and build profile restrictions
+// depend on the build environment and are not checked.
+func (r Relation) Satisfies(p *Package) bool {
+	switch r.ArchQualifier {
+	case "", "native":
+	case "any":
+		if p.MultiArch != "allowed" {
+			return false
+		}
+	default:
+		if p.Architecture != r.ArchQualifier {
+			return false
+		}
+	}
+	if p.Package == r.Name {
+		v, err := ParseVersion(p.Version)
+		if err != nil {
+			return r.Operator == ""
+		}
+		return r.SatisfiedByVersion(v)
+	}
+	provides, err := ParseRelations(p.Provides)
+	if err != nil {
+		return false
+	}
+	for _, alternatives := range provides {
+		for _, provided := range alternatives {
+			if provided.Name != r.Name {
+				continue
+			}
+			if r.Operator == "" {
+				return true
+			}
+			if provided.Operator == "=" && r.SatisfiedByVersion(provided.Version) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Satisfies reports whether any relation in a is satisfied by p.
+func (a Alternatives) Satisfies(p *Package) bool {
+	for _, r := range a {
+		if r.Satisfies(p) {
+			return true
+		}
+	}
+	return false
+}
+
+// AppliesToArchitecture reports whether the architecture restriction list of
+// r includes arch. A relation without a restriction list applies to every
+// architecture.
+func (r Relation) AppliesToArchitecture(arch string) bool {
+	if len(r.Architectures) == 0 {
+		return true
+	}
+	negated := strings.HasPrefix(r.Architectures[0], "!")
+	for _, a := range r.Architectures {
+		if strings.TrimPrefix(a, "!") == arch || a == "any" {
+			return !negated
+		}
+	}
+	return negated
+}
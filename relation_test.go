@@ -0,0 +1,163 @@
+package debrepo
+
+import (
+	"reflect"
+	"testing"
+)
+
+func mustParseVersion(s string) Version {
+	v, err := ParseVersion(s)
+	if err != nil {
+		panic(err)
+	}
+	return v
+}
+
+func TestParseRelations(t *testing.T) {
+	tests := []struct {
+		field     string
+		relations Relations
+		str       string
+	}{
+		{
+			field:     "libc6",
+			relations: Relations{{{Name: "libc6"}}},
+			str:       "libc6",
+		},
+		{
+			field: "libc6 (>= 2.14), libgl1-mesa-glx | libgl1",
+			relations: Relations{
+				{{Name: "libc6", Operator: ">=", Version: mustParseVersion("2.14")}},
+				{{Name: "libgl1-mesa-glx"}, {Name: "libgl1"}},
+			},
+			str: "libc6 (>= 2.14), libgl1-mesa-glx | libgl1",
+		},
+		{
+			field: "debhelper (>= 9~),\n dh-python:native,\n python3:any (>= 3.4),\n libc6-dev [amd64 !i386] <!nocheck> <stage1 !cross>",
+			relations: Relations{
+				{{Name: "debhelper", Operator: ">=", Version: mustParseVersion("9~")}},
+				{{Name: "dh-python", ArchQualifier: "native"}},
+				{{Name: "python3", ArchQualifier: "any", Operator: ">=", Version: mustParseVersion("3.4")}},
+				{{
+					Name:          "libc6-dev",
+					Architectures: []string{"amd64", "!i386"},
+					Profiles:      [][]string{{"!nocheck"}, {"stage1", "!cross"}},
+				}},
+			},
+			str: "debhelper (>= 9~), dh-python:native, python3:any (>= 3.4), libc6-dev [amd64 !i386] <!nocheck> <stage1 !cross>",
+		},
+		{
+			field:     "foo(<<1:2.0-1),bar (< 1), baz (> 2), ",
+			relations: Relations{{{Name: "foo", Operator: "<<", Version: mustParseVersion("1:2.0-1")}}, {{Name: "bar", Operator: "<=", Version: mustParseVersion("1")}}, {{Name: "baz", Operator: ">=", Version: mustParseVersion("2")}}},
+			str:       "foo (<< 1:2.0-1), bar (<= 1), baz (>= 2)",
+		},
+		{
+			field: "",
+			str:   "",
+		},
+	}
+	for i, tt := range tests {
+		relations, err := ParseRelations(tt.field)
+		if err != nil {
+			t.Fatalf("test(%v): %v", i, err)
+		}
+		if expected, actual := tt.relations, relations; !reflect.DeepEqual(expected, actual) {
+			t.Fatalf("test(%v): expected=%+v actual=%+v", i, expected, actual)
+		}
+		if expected, actual := tt.str, relations.String(); expected != actual {
+			t.Fatalf("test(%v): expected=%q actual=%q", i, expected, actual)
+		}
+	}
+}
+
+func TestParseRelations_Invalid(t *testing.T) {
+	tests := []string{
+		"Libc6",
+		"libc6 (>= )",
+		"libc6 (>= 2.14",
+		"libc6 (~= 2.14)",
+		"libc6 (2.14)",
+		"libc6 [amd64",
+		"libc6 []",
+		"libc6 <>",
+		"libc6:",
+		"libc6 | ",
+		"libc6 trailing",
+		"libc6 (>= 2.14) [amd64] <!nocheck> extra",
+	}
+	for i, tt := range tests {
+		if _, err := ParseRelations(tt); err != InvalidRelation {
+			t.Fatalf("test(%v) %q: expected=%v actual=%v", i, tt, InvalidRelation, err)
+		}
+	}
+}
+
+func TestRelation_Satisfies(t *testing.T) {
+	bash := &Package{Package: "bash", Version: "4.3-11+b1", Architecture: "amd64", MultiArch: "foreign"}
+	python := &Package{Package: "python3", Version: "3.4.2-2", Architecture: "amd64", MultiArch: "allowed"}
+	mta := &Package{Package: "exim4-daemon-light", Version: "4.84-8", Provides: "mail-transport-agent, exim4-daemon (= 4.84-8)"}
+	tests := []struct {
+		relation string
+		pkg      *Package
+		valid    bool
+	}{
+		{"bash", bash, true},
+		{"bash (>= 4.3)", bash, true},
+		{"bash (>> 4.3-11+b1)", bash, false},
+		{"bash (= 4.3-11+b1)", bash, true},
+		{"bash (<< 4.3-11+b2)", bash, true},
+		{"bash (<= 4.3-11)", bash, false},
+		{"bash:amd64", bash, true},
+		{"bash:i386", bash, false},
+		{"bash:any", bash, false},
+		{"python3:any (>= 3.4)", python, true},
+		{"dash", bash, false},
+		{"mail-transport-agent", mta, true},
+		{"mail-transport-agent (>= 1)", mta, false},
+		{"exim4-daemon (>= 4.80)", mta, true},
+		{"exim4-daemon (>> 4.84-8)", mta, false},
+	}
+	for i, tt := range tests {
+		relations, err := ParseRelations(tt.relation)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if expected, actual := tt.valid, relations[0][0].Satisfies(tt.pkg); expected != actual {
+			t.Fatalf("test(%v) %q: expected=%v actual=%v", i, tt.relation, expected, actual)
+		}
+	}
+}
+
+func TestAlternatives_Satisfies(t *testing.T) {
+	relations, err := ParseRelations("libgl1-mesa-glx | libgl1 (>= 1.0)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !relations[0].Satisfies(&Package{Package: "libgl1", Version: "1.1"}) {
+		t.Fatal("expected second alternative to be satisfied")
+	}
+	if relations[0].Satisfies(&Package{Package: "libgl1", Version: "0.9"}) {
+		t.Fatal("expected alternatives not to be satisfied")
+	}
+}
+
+func TestRelation_AppliesToArchitecture(t *testing.T) {
+	tests := []struct {
+		archs []string
+		arch  string
+		valid bool
+	}{
+		{nil, "amd64", true},
+		{[]string{"amd64", "i386"}, "amd64", true},
+		{[]string{"amd64", "i386"}, "arm64", false},
+		{[]string{"!amd64", "!i386"}, "amd64", false},
+		{[]string{"!amd64", "!i386"}, "arm64", true},
+		{[]string{"any"}, "arm64", true},
+	}
+	for i, tt := range tests {
+		r := Relation{Name: "foo", Architectures: tt.archs}
+		if expected, actual := tt.valid, r.AppliesToArchitecture(tt.arch); expected != actual {
+			t.Fatalf("test(%v): expected=%v actual=%v", i, expected, actual)
+		}
+	}
+}
@@ -1,9 +1,11 @@
 package debrepo
 
 import (
+	"crypto"
 	"crypto/md5"
 	"crypto/sha1"
 	"crypto/sha256"
+	"crypto/sha512"
 	"errors"
 	"fmt"
 	"reflect"
@@ -42,6 +44,7 @@ type Release struct {
 	MD5Sum     map[string]MD5FileMetaData
 	SHA1       map[string]SHA1FileMetaData
 	SHA256     map[string]SHA256FileMetaData
+	SHA512     map[string]SHA512FileMetaData
 
 	// The NotAutomatic and ButAutomaticUpgrades fields are optional boolean
 	// fields instructing the package manager. They may contain the values "yes"
@@ -86,15 +89,42 @@ type Release struct {
 	SignedBy [][20]byte
 }
 
-// Validate validates the field values in Release.
+// Validate validates the field values in Release. The checksums are checked
+// against DefaultHashPolicy.
 func (r *Release) Validate() error {
-	return (&releaseValidator{Release: r}).validate()
+	rv := &releaseValidator{Release: r, policy: DefaultHashPolicy, validity: DefaultValidityPolicy, checkValidUntil: true}
+	return rv.validate()
 }
 
 // ReleaseValidator validates field values in a Release.
 type releaseValidator struct {
 	*Release
-	err error
+	// flat is set for the Release of a flat repository, which may omit the
+	// Components and Architectures fields.
+	flat bool
+	// policy is the HashPolicy the checksums must satisfy. Warnings reported
+	// by the policy are collected in warnings.
+	policy   HashPolicy
+	warnings []string
+	// validity is the ValidityPolicy the Date and Valid-Until fields are
+	// checked against. Valid-Until is ignored unless checkValidUntil is set.
+	validity        ValidityPolicy
+	checkValidUntil bool
+	// err is the last problem found and problems holds all of them.
+	err      error
+	problems []releaseProblem
+}
+
+// A releaseProblem is a validation failure of the field named field, which is
+// empty if the problem concerns the Release as a whole.
+type releaseProblem struct {
+	field string
+	err   error
+}
+
+func (rv *releaseValidator) fail(field string, err error) {
+	rv.err = err
+	rv.problems = append(rv.problems, releaseProblem{field: field, err: err})
 }
 
 // Validate returns an error if field validation fails.
@@ -112,19 +142,25 @@ func (rv *releaseValidator) validate() error {
 }
 
 func (rv *releaseValidator) validateComponents() {
+	if rv.flat && rv.Components == nil {
+		return
+	}
 	if len(rv.Components) == 0 {
-		rv.err = errors.New("field components empty")
+		rv.fail("Components", errors.New("field components empty"))
 	}
 	for _, v := range rv.Components {
 		if len(v) == 0 {
-			rv.err = errors.New("empty component")
+			rv.fail("Components", errors.New("empty component"))
 		}
 	}
 }
 
 func (rv *releaseValidator) validateArchitectures() {
+	if rv.flat && rv.Architectures == nil {
+		return
+	}
 	if rv.Architectures == nil || len(rv.Architectures) == 0 {
-		rv.err = errors.New("field Architectures empty")
+		rv.fail("Architectures", errors.New("field Architectures empty"))
 		return
 	}
 	for _, v := range rv.Architectures {
@@ -136,7 +172,7 @@ func (rv *releaseValidator) validateArchitectures() {
 			}
 		}
 		if !valid {
-			rv.err = fmt.Errorf("unsupported architecture: %s", v)
+			rv.fail("Architectures", fmt.Errorf("unsupported architecture: %s", v))
 			return
 		}
 	}
@@ -146,7 +182,7 @@ func (rv *releaseValidator) validateArchitectures() {
 func (rv *releaseValidator) validateNoSupportForArchitectureAll() {
 	if rv.NoSupportForArchitectureAll != "" &&
 		rv.NoSupportForArchitectureAll != "Packages" {
-		rv.err = errors.New("invalid value for NoSupportForArchitectureAll")
+		rv.fail("No-Support-for-Architecture-all", errors.New("invalid value for NoSupportForArchitectureAll"))
 	}
 }
 
@@ -164,62 +200,103 @@ func (rv *releaseValidator) validateOptionalSingleWordFields() {
 
 func (rv *releaseValidator) validateSingleLineOrEmpty(field, str string) {
 	if strings.Index(str, "\n") != -1 {
-		rv.err = fmt.Errorf("field %s can not contain multiple lines", field)
+		rv.fail(field, fmt.Errorf("field %s can not contain multiple lines", field))
 	}
 }
 
 func (rv *releaseValidator) validateSingleWordOrEmpty(field, str string) {
 	if strings.Index(str, "\n") != -1 ||
 		strings.Index(str, " ") != -1 {
-		rv.err = fmt.Errorf("field %s can contain only a single word", field)
+		rv.fail(field, fmt.Errorf("field %s can contain only a single word", field))
 	}
 }
 
 func (rv *releaseValidator) validateDate() {
 	if rv.Date.IsZero() {
-		rv.err = errors.New("field date can not be empty")
+		rv.fail("Date", errors.New("field date can not be empty"))
+		return
+	}
+	if err := rv.validity.checkDate(rv.Release); err != nil {
+		rv.fail("Date", err)
 	}
 }
 
 func (rv *releaseValidator) validateValidUntil() {
-	if rv.ValidUntil.IsZero() {
+	if !rv.checkValidUntil {
 		return
 	}
-	if time.Now().After(rv.ValidUntil) {
-		rv.err = errors.New("release file is expired")
+	if err := rv.validity.checkValidUntil(rv.Release); err != nil {
+		rv.fail("Valid-Until", err)
 	}
 }
 
 func (rv *releaseValidator) validateFileSums() {
 	if len(rv.MD5Sum) == 0 &&
 		len(rv.SHA1) == 0 &&
-		len(rv.SHA256) == 0 {
-		rv.err = errors.New("no files in release file")
+		len(rv.SHA256) == 0 &&
+		len(rv.SHA512) == 0 {
+		rv.fail("", errors.New("no files in release file"))
 		return
 	}
-	validateNotZeroLength := func(fileSums interface{}) {
+	n := len(rv.problems)
+	validateNotZeroLength := func(field string, fileSums interface{}) {
 		if fileSums == nil {
 			return
 		}
 		keys := reflect.ValueOf(fileSums).MapKeys()
 		for _, k := range keys {
 			if len(k.String()) == 0 {
-				rv.err = errors.New("empty filename in release file")
+				rv.fail(field, errors.New("empty filename in release file"))
 				return
 			}
 		}
 	}
-	validateNotZeroLength(rv.MD5Sum)
-	validateNotZeroLength(rv.SHA1)
-	validateNotZeroLength(rv.SHA256)
+	validateNotZeroLength("MD5Sum", rv.MD5Sum)
+	validateNotZeroLength("SHA1", rv.SHA1)
+	validateNotZeroLength("SHA256", rv.SHA256)
+	validateNotZeroLength("SHA512", rv.SHA512)
+	if len(rv.problems) > n {
+		return
+	}
+	warnings, err := rv.policy.Check(rv.Release)
+	if err != nil {
+		rv.fail("", err)
+		return
+	}
+	rv.warnings = append(rv.warnings, warnings...)
 }
 
 func (rv *releaseValidator) validateAutomatic() {
 	if !rv.NotAutomatic && rv.ButAutomaticUpgrades {
-		rv.err = errors.New("can not set ButAutomaticUpgrades without NotAutomatic")
+		rv.fail("ButAutomaticUpgrades", errors.New("can not set ButAutomaticUpgrades without NotAutomatic"))
 	}
 }
 
+// fileChecksum is a checksum of a file listed in a Release file.
+type fileChecksum struct {
+	Hash   crypto.Hash
+	Sum    []byte
+	Length int64
+}
+
+// checksum returns the strongest checksum listed for the file at path,
+// relative to the "dists/$DIST" directory.
+func (r *Release) checksum(path string) (fileChecksum, bool) {
+	if m, ok := r.SHA512[path]; ok {
+		return fileChecksum{crypto.SHA512, m.Sum[:], m.Length}, true
+	}
+	if m, ok := r.SHA256[path]; ok {
+		return fileChecksum{crypto.SHA256, m.Sum[:], m.Length}, true
+	}
+	if m, ok := r.SHA1[path]; ok {
+		return fileChecksum{crypto.SHA1, m.Sum[:], m.Length}, true
+	}
+	if m, ok := r.MD5Sum[path]; ok {
+		return fileChecksum{crypto.MD5, m.Sum[:], m.Length}, true
+	}
+	return fileChecksum{}, false
+}
+
 // MD5FileMetaData stores the MD5 sum and file length of a file in a repository
 // Release file.
 type MD5FileMetaData struct {
@@ -240,3 +317,10 @@ type SHA256FileMetaData struct {
 	Length int64
 	Sum    [sha256.Size]byte
 }
+
+// SHA512FileMetaData stores the SHA512 sum and file length of a file in a
+// repository Release file.
+type SHA512FileMetaData struct {
+	Length int64
+	Sum    [sha512.Size]byte
+}
@@ -6,6 +6,7 @@ import (
 	"crypto/md5"
 	"crypto/sha1"
 	"crypto/sha256"
+	"crypto/sha512"
 	"encoding/hex"
 	"errors"
 	"fmt"
@@ -16,109 +17,227 @@ import (
 	"time"
 )
 
-// ReadRelease returns a Release from a Release file.
-func ReadRelease(r io.Reader) (release *Release, err error) {
-	defer func() {
-		if p := recover(); p != nil {
-			release = nil
-			err = fmt.Errorf("parsing error: %s", p)
+// ReadRelease returns a Release from a Release file. It fails on the first
+// problem found, which is reported as a *ParseError.
+func ReadRelease(r io.Reader) (*Release, error) {
+	release, _, err := (&ReleaseParser{}).Parse(r)
+	return release, err
+}
+
+// A ReleaseParser reads Release files. The zero value is a strict parser
+// which behaves like ReadRelease.
+type ReleaseParser struct {
+	// File is the name of the file being parsed, which is reported in the
+	// File field of ParseErrors.
+	File string
+	// Lenient makes the parser skip malformed lines, invalid fields and
+	// checksum entries instead of failing, decode the fields of additional
+	// paragraphs, and accept a Release which fails validation. The problems
+	// found are returned as warnings along with the Release.
+	Lenient bool
+	// Validity is the ValidityPolicy the Date and Valid-Until fields are
+	// checked against. If it is nil, DefaultValidityPolicy is used.
+	Validity *ValidityPolicy
+}
+
+// Parse returns a Release from a Release file. Problems with the file are
+// reported as a *ParseError, which locates the field when the problem
+// concerns a single field. In lenient mode, the problems which were ignored
+// are returned as well, and an error is only returned if the file can not be
+// read at all.
+func (rp *ReleaseParser) Parse(r io.Reader) (*Release, []*ParseError, error) {
+	d := &releaseDecoder{file: rp.File, lenient: rp.Lenient}
+	release, err := d.decode(r)
+	if err != nil {
+		return nil, nil, err
+	}
+	validity := DefaultValidityPolicy
+	if rp.Validity != nil {
+		validity = *rp.Validity
+	}
+	rv := &releaseValidator{Release: release, policy: DefaultHashPolicy, validity: validity, checkValidUntil: true}
+	rv.validate()
+	for _, problem := range rv.problems {
+		if err := d.report(d.lines[strings.ToLower(problem.field)], problem.field, problem.err); err != nil {
+			return nil, nil, err
 		}
-	}()
-	scanner := bufio.NewScanner(r)
-	release = &Release{
+	}
+	for _, w := range rv.warnings {
+		d.report(0, "", errors.New(w))
+	}
+	return release, d.warnings, nil
+}
+
+// parseRelease decodes a Release file without validating the Release.
+func parseRelease(r io.Reader) (*Release, error) {
+	return (&releaseDecoder{}).decode(r)
+}
+
+// A releaseDecoder decodes the fields of a Release file. In lenient mode
+// problems are collected in warnings instead of being returned.
+type releaseDecoder struct {
+	file     string
+	lenient  bool
+	warnings []*ParseError
+	// lines holds the line number of each decoded field, keyed by the lower
+	// case field name.
+	lines map[string]int
+}
+
+// report returns a *ParseError for err, or records it as a warning and
+// returns nil in lenient mode.
+func (d *releaseDecoder) report(line int, field string, err error) error {
+	perr := &ParseError{File: d.file, Line: line, Field: field, Err: err}
+	if !d.lenient {
+		return perr
+	}
+	d.warnings = append(d.warnings, perr)
+	return nil
+}
+
+func (d *releaseDecoder) decode(r io.Reader) (*Release, error) {
+	pr := NewParagraphReader(r)
+	pr.skipInvalid = d.lenient
+	release := &Release{
 		MD5Sum:   make(map[string]MD5FileMetaData),
 		SHA1:     make(map[string]SHA1FileMetaData),
 		SHA256:   make(map[string]SHA256FileMetaData),
+		SHA512:   make(map[string]SHA512FileMetaData),
 		SignedBy: make([][20]byte, 0),
 	}
-
-	var fileSum string
-	for scanner.Scan() {
-		line := scanner.Text()
-		words := strings.Split(line, " ")
-		if len(words) == 0 {
-			continue
+	d.lines = make(map[string]int)
+	for n := 0; ; n++ {
+		paragraph, err := pr.Read()
+		for _, line := range pr.invalid {
+			d.report(line, "", InvalidParagraph)
 		}
-		switch words[0] {
-		case "Description:":
-			release.Description = strings.Join(words[1:], " ")
-		case "Origin:":
-			release.Origin = strings.Join(words[1:], " ")
-		case "Label:":
-			release.Label = strings.Join(words[1:], " ")
-		case "Version:":
-			release.Version = words[1]
-		case "Suite:":
-			release.Suite = words[1]
-		case "Codename:":
-			release.Codename = words[1]
-		case "No-Support-for-Architecture-all:":
-			release.NoSupportForArchitectureAll = words[1]
-		case "Components:":
-			release.Components = words[1:]
-		case "Architectures:":
-			release.Architectures = words[1:]
-		case "Date:":
-			release.Date = parseDate(strings.Join(words[1:], " "))
-		case "Valid-Until:":
-			release.ValidUntil = parseDate(strings.Join(words[1:], " "))
-		case "MD5Sum:":
-			fileSum = "MD5Sum"
-		case "SHA1:":
-			fileSum = "SHA1"
-		case "SHA256:":
-			fileSum = "SHA256"
-		case "":
-			sum, length, path := parseFileSumParams(words)
-			b, err := hex.DecodeString(sum)
-			if err != nil {
-				panic(err)
+		pr.invalid = nil
+		if err == io.EOF {
+			if n == 0 {
+				return nil, &ParseError{File: d.file, Err: errors.New("empty release file")}
 			}
-			switch fileSum {
-			case "MD5Sum":
-				var bb [md5.Size]byte
-				copy(bb[:], b)
-				release.MD5Sum[path] = MD5FileMetaData{Length: length, Sum: bb}
-			case "SHA1":
-				var bb [sha1.Size]byte
-				copy(bb[:], b)
-				release.SHA1[path] = SHA1FileMetaData{Length: length, Sum: bb}
-			case "SHA256":
-				var bb [sha256.Size]byte
-				copy(bb[:], b)
-				release.SHA256[path] = SHA256FileMetaData{Length: length, Sum: bb}
+			return release, nil
+		}
+		if err == InvalidParagraph {
+			return nil, &ParseError{File: d.file, Line: pr.line, Err: err}
+		}
+		if err != nil {
+			return nil, err
+		}
+		// A Release file consists of a single paragraph. The fields of any
+		// further paragraphs, such as checksums separated by a stray blank
+		// line, are decoded as well in lenient mode.
+		if n > 0 {
+			if err := d.report(pr.start, "", errors.New("unexpected paragraph in release file")); err != nil {
+				return nil, err
 			}
-		case "NotAutomatic:":
-			release.NotAutomatic = parseOptionalBool(words[1], "NotAutomatic")
-		case "ButAutomaticUpgrades:":
-			release.ButAutomaticUpgrades = parseOptionalBool(words[1], "ButAutomaticUpgrades")
-		case "Acquire-By-Hash:":
-			release.AcquireByHash = parseOptionalBool(words[1], "Acquire-By-Hash")
-		case "Signed-By:":
-			fingerprintLine := strings.Join(words[1:], "")
-			fingerprints := strings.Split(fingerprintLine, ",")
-			for _, f := range fingerprints {
-				f = strings.TrimSpace(f)
-				b, err := hex.DecodeString(f)
-				if err != nil {
-					return nil, err
-				}
-				if len(b) != 20 {
-					return nil, errors.New("invalid fingerprint in Signed-By")
-				}
-				var bb [20]byte
-				copy(bb[:], b)
-				release.SignedBy = append(release.SignedBy, bb)
+		}
+		for i, f := range paragraph {
+			if err := d.decodeField(release, f, pr.lines[i]); err != nil {
+				return nil, err
 			}
 		}
 	}
-	if err := scanner.Err(); err != nil {
-		return nil, err
+}
+
+// decodeField decodes the field f, which starts at line, into release.
+func (d *releaseDecoder) decodeField(release *Release, f Field, line int) error {
+	if _, ok := d.lines[strings.ToLower(f.Name)]; !ok {
+		d.lines[strings.ToLower(f.Name)] = line
 	}
-	if err := release.Validate(); err != nil {
-		return nil, err
+	var err error
+	switch strings.ToLower(f.Name) {
+	case "description":
+		release.Description = f.Value
+	case "origin":
+		release.Origin = f.Value
+	case "label":
+		release.Label = f.Value
+	case "version":
+		release.Version = f.Value
+	case "suite":
+		release.Suite = f.Value
+	case "codename":
+		release.Codename = f.Value
+	case "no-support-for-architecture-all":
+		release.NoSupportForArchitectureAll = f.Value
+	case "components":
+		release.Components = strings.Fields(f.Value)
+	case "architectures":
+		release.Architectures = strings.Fields(f.Value)
+	case "date":
+		release.Date, err = parseDate(f.Value)
+	case "valid-until":
+		release.ValidUntil, err = parseDate(f.Value)
+	case "md5sum":
+		if err := d.decodeFileSums(f, line, md5.Size, func(path string, length int64, sum []byte) {
+			var bb [md5.Size]byte
+			copy(bb[:], sum)
+			release.MD5Sum[path] = MD5FileMetaData{Length: length, Sum: bb}
+		}); err != nil {
+			return err
+		}
+	case "sha1":
+		if err := d.decodeFileSums(f, line, sha1.Size, func(path string, length int64, sum []byte) {
+			var bb [sha1.Size]byte
+			copy(bb[:], sum)
+			release.SHA1[path] = SHA1FileMetaData{Length: length, Sum: bb}
+		}); err != nil {
+			return err
+		}
+	case "sha256":
+		if err := d.decodeFileSums(f, line, sha256.Size, func(path string, length int64, sum []byte) {
+			var bb [sha256.Size]byte
+			copy(bb[:], sum)
+			release.SHA256[path] = SHA256FileMetaData{Length: length, Sum: bb}
+		}); err != nil {
+			return err
+		}
+	case "sha512":
+		if err := d.decodeFileSums(f, line, sha512.Size, func(path string, length int64, sum []byte) {
+			var bb [sha512.Size]byte
+			copy(bb[:], sum)
+			release.SHA512[path] = SHA512FileMetaData{Length: length, Sum: bb}
+		}); err != nil {
+			return err
+		}
+	case "notautomatic":
+		release.NotAutomatic, err = parseBool("NotAutomatic", f.Value)
+	case "butautomaticupgrades":
+		release.ButAutomaticUpgrades, err = parseBool("ButAutomaticUpgrades", f.Value)
+	case "acquire-by-hash":
+		release.AcquireByHash, err = parseBool("Acquire-By-Hash", f.Value)
+	case "signed-by":
+		var fingerprints [][20]byte
+		if fingerprints, err = parseSignedBy(f.Value); err == nil {
+			release.SignedBy = append(release.SignedBy, fingerprints...)
+		}
 	}
-	return release, nil
+	if err != nil {
+		return d.report(line, f.Name, err)
+	}
+	return nil
+}
+
+// decodeFileSums calls add for each entry of the checksum field f, which
+// starts at line. Invalid entries are reported.
+func (d *releaseDecoder) decodeFileSums(f Field, line, size int, add func(path string, length int64, sum []byte)) error {
+	// The entries usually start on the line following the field name.
+	if strings.HasPrefix(f.Value, "\n") {
+		line++
+	}
+	for i, entry := range fileSumLines(f.Value) {
+		sum := make([]byte, size)
+		length, path, err := parseFileSum(entry, sum)
+		if err != nil {
+			if err := d.report(line+i, f.Name, err); err != nil {
+				return err
+			}
+			continue
+		}
+		add(path, length, sum)
+	}
+	return nil
 }
 
 // Serialize saves a Release to a file.
@@ -145,46 +264,58 @@ func (r *Release) Serialize(out io.Writer) error {
 	return scanner.Err()
 }
 
-func parseFileSumParams(words []string) (sum string, length int64, path string) {
-	var parsed int
-	for _, w := range words {
-		if len(w) > 0 {
-			switch parsed {
-			case 0:
-				sum = w
-			case 1:
-				i, err := strconv.ParseInt(w, 10, 64)
-				if err != nil {
-					panic(err)
-				}
-				length = i
-			case 2:
-				path = w
-			}
-			parsed++
+// fileSumLines returns the non-empty lines of a checksum field value.
+func fileSumLines(value string) []string {
+	var lines []string
+	for _, line := range strings.Split(value, "\n") {
+		if len(strings.TrimSpace(line)) > 0 {
+			lines = append(lines, line)
 		}
 	}
-	return
+	return lines
+}
+
+// parseFileSum parses a checksum entry of a Release file, decoding the
+// checksum into sum.
+func parseFileSum(line string, sum []byte) (length int64, path string, err error) {
+	words := strings.Fields(line)
+	if len(words) != 3 {
+		return 0, "", fmt.Errorf("invalid file checksum line: %s", strings.TrimSpace(line))
+	}
+	if length, err = strconv.ParseInt(words[1], 10, 64); err != nil || length < 0 {
+		return 0, "", fmt.Errorf("invalid file size: %s", words[1])
+	}
+	if err := decodeHexSum(sum, words[0]); err != nil {
+		return 0, "", err
+	}
+	return length, words[2], nil
 }
 
-func parseDate(value string) time.Time {
+func parseDate(value string) (time.Time, error) {
 	date, err := time.Parse(time.RFC1123, value)
 	if err != nil {
 		date, err = time.Parse(time.RFC1123Z, value)
 		if err != nil {
-			panic(err)
+			return time.Time{}, fmt.Errorf("invalid date: %s", value)
 		}
 	}
-	return date
+	return date, nil
 }
 
-func parseOptionalBool(word, field string) bool {
-	if word == "yes" {
-		return true
-	} else if word == "no" {
-		return false
+// parseSignedBy parses the comma separated fingerprints of the Signed-By
+// field.
+func parseSignedBy(value string) ([][20]byte, error) {
+	var fingerprints [][20]byte
+	for _, f := range strings.Split(strings.Join(strings.Fields(value), ""), ",") {
+		b, err := hex.DecodeString(f)
+		if err != nil || len(b) != 20 {
+			return nil, fmt.Errorf("invalid fingerprint: %s", f)
+		}
+		var bb [20]byte
+		copy(bb[:], b)
+		fingerprints = append(fingerprints, bb)
 	}
-	panic(fmt.Errorf("invalid value for %s", field))
+	return fingerprints, nil
 }
 
 const releaseTemplateStr = `{{with .Origin}}Origin: {{.}}{{end}}
@@ -217,6 +348,11 @@ SHA256:
 {{range $key, $value := .}} {{printf "%s %8d %s" (hex32 .Sum) .Length $key}}
 {{end}}
 {{- end -}}
+{{with .SHA512 -}}
+SHA512:
+{{range $key, $value := .}} {{printf "%s %8d %s" (hex64 .Sum) .Length $key}}
+{{end}}
+{{- end -}}
 `
 
 var releaseTemplateFuncs = template.FuncMap{
@@ -257,6 +393,11 @@ var releaseTemplateFuncs = template.FuncMap{
 		copy(bb, b[:])
 		return hex.EncodeToString(bb)
 	},
+	"hex64": func(b [sha512.Size]byte) string {
+		bb := make([]byte, sha512.Size)
+		copy(bb, b[:])
+		return hex.EncodeToString(bb)
+	},
 }
 
 var releaseTemplate = template.Must(template.New("").Funcs(releaseTemplateFuncs).Parse(releaseTemplateStr))
@@ -2,9 +2,12 @@ package debrepo
 
 import (
 	"bytes"
+	"crypto/sha512"
+	"fmt"
 	"io/ioutil"
 	"os"
 	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -60,3 +63,179 @@ func TestRelease_Serialize(t *testing.T) {
 		t.Fatal("expected != actual")
 	}
 }
+
+func TestRelease_SHA512(t *testing.T) {
+	release, err := ioutil.ReadFile("testdata/repo/root/debian/dists/jessie/Release")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sum := sha512.Sum512([]byte("Packages"))
+	section := fmt.Sprintf("SHA512:\n %x %8d %s\n", sum, 8, "main/binary-amd64/Packages")
+	r, err := ReadRelease(bytes.NewReader(append(release, section...)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]SHA512FileMetaData{"main/binary-amd64/Packages": {Length: 8, Sum: sum}}
+	if actual := r.SHA512; !reflect.DeepEqual(expected, actual) {
+		t.Fatalf("expected=%v actual=%v", expected, actual)
+	}
+	if _, ok := r.SHA256["main/binary-amd64/Packages"]; !ok {
+		t.Fatal("expected SHA256 section to be preserved")
+	}
+
+	buf := &bytes.Buffer{}
+	if err := r.Serialize(buf); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasSuffix(buf.String(), "\n"+section) {
+		t.Fatalf("expected serialized release to end with %q", section)
+	}
+}
+
+// brokenTestRelease returns the test Release file with an invalid Date, an
+// invalid MD5Sum entry on line 12 and an invalid Acquire-By-Hash field on the
+// last line.
+func brokenTestRelease(t *testing.T) []byte {
+	b, err := ioutil.ReadFile("testdata/repo/root/debian/dists/jessie/Release")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b = bytes.Replace(b, []byte("Date: Sat, 02 Apr 2016 09:54:11 UTC"), []byte("Date: yesterday"), 1)
+	b = bytes.Replace(b, []byte("    88515 contrib/Contents-amd64.gz"), []byte("    88515x contrib/Contents-amd64.gz"), 1)
+	return append(b, "Acquire-By-Hash: maybe\n"...)
+}
+
+func TestReleaseParser_Parse(t *testing.T) {
+	b := brokenTestRelease(t)
+	lines := bytes.Count(b, []byte("\n"))
+
+	_, err := ReadRelease(bytes.NewReader(b))
+	perr, ok := err.(*ParseError)
+	if !ok {
+		t.Fatalf("expected=*ParseError actual=%v", err)
+	}
+	if expected, actual := (ParseError{Line: 6, Field: "Date"}), (ParseError{Line: perr.Line, Field: perr.Field}); expected != actual {
+		t.Fatalf("expected=%v actual=%v", expected, actual)
+	}
+	_, _, err = (&ReleaseParser{File: "Release"}).Parse(bytes.NewReader(b))
+	if expected, actual := "Release:6: Date: invalid date: yesterday", fmt.Sprint(err); expected != actual {
+		t.Fatalf("expected=%v actual=%v", expected, actual)
+	}
+
+	release, warnings, err := (&ReleaseParser{File: "Release", Lenient: true}).Parse(bytes.NewReader(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected, actual := "jessie", release.Codename; expected != actual {
+		t.Fatalf("expected=%v actual=%v", expected, actual)
+	}
+	if _, ok := release.MD5Sum["contrib/Contents-amd64.gz"]; ok {
+		t.Fatal("expected invalid MD5Sum entry to be skipped")
+	}
+	if _, ok := release.MD5Sum["contrib/Contents-amd64"]; !ok {
+		t.Fatal("expected valid MD5Sum entry")
+	}
+	tests := []struct {
+		line  int
+		field string
+	}{
+		{6, "Date"},
+		{12, "MD5Sum"},
+		{lines, "Acquire-By-Hash"},
+		{6, "Date"}, // The missing Date fails validation.
+	}
+	if expected, actual := len(tests), len(warnings); expected != actual {
+		t.Fatalf("expected=%v actual=%v (%v)", expected, actual, warnings)
+	}
+	for i, tt := range tests {
+		w := warnings[i]
+		if expected, actual := tt, (struct {
+			line  int
+			field string
+		}{w.Line, w.Field}); expected != actual {
+			t.Fatalf("test(%v): expected=%v actual=%v", i, expected, actual)
+		}
+		if expected, actual := "Release", w.File; expected != actual {
+			t.Fatalf("test(%v): expected=%v actual=%v", i, expected, actual)
+		}
+	}
+}
+
+func TestReleaseParser_Parse_Malformed(t *testing.T) {
+	b, err := ioutil.ReadFile("testdata/repo/root/debian/dists/jessie/Release")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A line without a colon on line 3 and a blank line before the MD5Sum
+	// field on line 11, which starts a second paragraph on line 12.
+	b = bytes.Replace(b, []byte("Suite: stable\n"), []byte("garbage\nSuite: stable\n"), 1)
+	b = bytes.Replace(b, []byte("MD5Sum:"), []byte("\nMD5Sum:"), 1)
+
+	_, err = ReadRelease(bytes.NewReader(b))
+	if perr, ok := err.(*ParseError); !ok || perr.Line != 3 || perr.Err != InvalidParagraph {
+		t.Fatalf("expected=line 3: %v actual=%v", InvalidParagraph, err)
+	}
+
+	release, warnings, err := (&ReleaseParser{Lenient: true}).Parse(bytes.NewReader(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected, actual := "stable", release.Suite; expected != actual {
+		t.Fatalf("expected=%v actual=%v", expected, actual)
+	}
+	if len(release.MD5Sum) < 500 || len(release.SHA256) < 500 {
+		t.Fatal("missing file sums")
+	}
+	var lines []int
+	for _, w := range warnings {
+		lines = append(lines, w.Line)
+	}
+	if expected, actual := []int{3, 12}, lines; !reflect.DeepEqual(expected, actual) {
+		t.Fatalf("expected=%v actual=%v (%v)", expected, actual, warnings)
+	}
+}
+
+func TestReadRelease_ValidationError(t *testing.T) {
+	b, err := ioutil.ReadFile("testdata/repo/root/debian/dists/jessie/Release")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		old, new string
+		line     int
+		field    string
+	}{
+		{"Components: main contrib non-free\n", "", 0, "Components"},
+		{"Architectures: amd64", "Architectures: amd64 pdp11", 7, "Architectures"},
+		{"Suite: stable", "Suite: old stable", 3, "Suite"},
+	}
+	for i, tt := range tests {
+		broken := bytes.Replace(b, []byte(tt.old), []byte(tt.new), 1)
+		_, _, err := (&ReleaseParser{File: "Release"}).Parse(bytes.NewReader(broken))
+		perr, ok := err.(*ParseError)
+		if !ok {
+			t.Fatalf("test(%v): expected=*ParseError actual=%v", i, err)
+		}
+		if expected, actual := (ParseError{File: "Release", Line: tt.line, Field: tt.field}), (ParseError{File: perr.File, Line: perr.Line, Field: perr.Field}); expected != actual {
+			t.Fatalf("test(%v): expected=%v actual=%v", i, expected, actual)
+		}
+	}
+}
+
+func TestParseError_Error(t *testing.T) {
+	cause := Error("cause")
+	tests := []struct {
+		err *ParseError
+		msg string
+	}{
+		{&ParseError{File: "Release", Line: 3, Field: "Date", Err: cause}, "Release:3: Date: cause"},
+		{&ParseError{File: "Release", Err: cause}, "Release: cause"},
+		{&ParseError{Line: 3, Err: cause}, "line 3: cause"},
+		{&ParseError{Field: "Date", Err: cause}, "Date: cause"},
+	}
+	for i, tt := range tests {
+		if expected, actual := tt.msg, tt.err.Error(); expected != actual {
+			t.Fatalf("test(%v): expected=%v actual=%v", i, expected, actual)
+		}
+	}
+}
@@ -0,0 +1,183 @@
+package debrepo
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ConflictingRelease is returned when a Release has the same Date as the last
+// Release accepted for its Source but different content, which indicates that
+// the repository was modified without updating the Date or that a mirror is
+// serving tampered metadata.
+const ConflictingRelease = Error("release file differs from the accepted release with the same date")
+
+// A ReleaseState records the last Release accepted for a Source. A newly
+// retrieved Release dated before the recorded Date is rejected with a
+// *StaleReleaseError.
+type ReleaseState struct {
+	// Date is the Date field of the Release.
+	Date time.Time
+	// SHA256 is the checksum of the signed content of the Release file. If it
+	// is zero, the content of a Release with the same Date is not compared.
+	SHA256 [sha256.Size]byte
+	// SignedBy holds the fingerprints of the Signed-By field of the Release.
+	// If it is not empty, the next Release must be signed by one of the keys.
+	SignedBy [][20]byte
+}
+
+// ReleaseState returns the state of the last Release accepted for the
+// distribution referenced by source. If the client has a cache directory, the
+// state is read from it if the client has not accepted a Release for the
+// distribution yet. An error is returned if the cached state can not be read.
+func (c *Client) ReleaseState(source *Source) (ReleaseState, bool, error) {
+	key, err := source.URL("")
+	if err != nil {
+		return ReleaseState{}, false, err
+	}
+	return c.releaseState(key)
+}
+
+// SetReleaseState records state as the state of the last Release accepted for
+// the distribution referenced by source. If the client has a cache directory,
+// the state is stored in it.
+func (c *Client) SetReleaseState(source *Source, state ReleaseState) error {
+	key, err := source.URL("")
+	if err != nil {
+		return err
+	}
+	defer c.lockReleaseState(key)()
+	return c.setReleaseState(key, state)
+}
+
+func (c *Client) releaseState(key string) (ReleaseState, bool, error) {
+	c.mu.Lock()
+	state, ok := c.states[key]
+	cache := c.cache
+	c.mu.Unlock()
+	if ok || cache == nil {
+		return state, ok, nil
+	}
+	return cache.loadReleaseState(key)
+}
+
+func (c *Client) setReleaseState(key string, state ReleaseState) error {
+	c.mu.Lock()
+	c.states[key] = state
+	cache := c.cache
+	c.mu.Unlock()
+	if cache == nil {
+		return nil
+	}
+	return cache.storeReleaseState(key, state)
+}
+
+// lockReleaseState locks the ReleaseState of the distribution identified by
+// key and returns a function which unlocks it.
+func (c *Client) lockReleaseState(key string) func() {
+	c.mu.Lock()
+	l, ok := c.stateLocks[key]
+	if !ok {
+		l = &sync.Mutex{}
+		c.stateLocks[key] = l
+	}
+	c.mu.Unlock()
+	l.Lock()
+	return l.Unlock
+}
+
+// checkReleaseState returns a *StaleReleaseError if the Release with the
+// state next is older than the last Release accepted for the distribution
+// identified by key, ConflictingRelease if it has the same Date but different
+// content, and UntrustedSigner if none of signers is permitted by the Signed-By
+// field of the last Release.
+func (c *Client) checkReleaseState(key string, next ReleaseState, signers []*Signer) error {
+	state, ok, err := c.releaseState(key)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return nil
+	}
+	if !(&Release{SignedBy: state.SignedBy}).acceptsAnySigner(signers) {
+		return UntrustedSigner
+	}
+	if next.Date.Before(state.Date) {
+		return &StaleReleaseError{Date: next.Date, LastDate: state.Date}
+	}
+	var unknown [sha256.Size]byte
+	if next.Date.Equal(state.Date) && state.SHA256 != unknown && next.SHA256 != state.SHA256 {
+		return ConflictingRelease
+	}
+	return nil
+}
+
+// releaseStatePath returns the path of the file holding the ReleaseState of
+// the distribution identified by key.
+func (mc *metadataCache) releaseStatePath(key string) string {
+	return mc.path(key) + ".state"
+}
+
+// loadReleaseState reads the ReleaseState of the distribution identified by
+// key. It returns false if no state is stored and an error if the stored state
+// can not be read, so that a damaged state file does not disable the checks.
+func (mc *metadataCache) loadReleaseState(key string) (ReleaseState, bool, error) {
+	path := mc.releaseStatePath(key)
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return ReleaseState{}, false, nil
+	}
+	if err != nil {
+		return ReleaseState{}, false, err
+	}
+	defer f.Close()
+	state, err := decodeReleaseState(f)
+	if err != nil {
+		return ReleaseState{}, false, fmt.Errorf("%s: %v", path, err)
+	}
+	return state, true, nil
+}
+
+func decodeReleaseState(r io.Reader) (ReleaseState, error) {
+	var state ReleaseState
+	p, err := NewParagraphReader(r).Read()
+	if err != nil {
+		return state, err
+	}
+	if state.Date, err = time.Parse(time.RFC1123, p.Get("Date")); err != nil {
+		return state, err
+	}
+	if err := decodeHexSum(state.SHA256[:], p.Get("SHA256")); err != nil {
+		return state, err
+	}
+	if signedBy, ok := p.Lookup("Signed-By"); ok {
+		if state.SignedBy, err = parseSignedBy(signedBy); err != nil {
+			return state, err
+		}
+	}
+	return state, nil
+}
+
+func (mc *metadataCache) storeReleaseState(key string, state ReleaseState) error {
+	var p Paragraph
+	p.Set("Date", state.Date.UTC().Format(time.RFC1123))
+	p.Set("SHA256", hex.EncodeToString(state.SHA256[:]))
+	if len(state.SignedBy) > 0 {
+		fingerprints := make([]string, 0, len(state.SignedBy))
+		for _, f := range state.SignedBy {
+			fingerprints = append(fingerprints, fmt.Sprintf("%X", f))
+		}
+		p.Set("Signed-By", strings.Join(fingerprints, ","))
+	}
+	buf := &bytes.Buffer{}
+	if err := WriteParagraphs(buf, []Paragraph{p}); err != nil {
+		return err
+	}
+	return mc.writeFile(mc.releaseStatePath(key), buf.Bytes())
+}
@@ -0,0 +1,195 @@
+package debrepo
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/openpgp"
+)
+
+// releaseStateTestServer serves a clearsigned copy of the test Release whose
+// Date field may be changed while the server is running.
+type releaseStateTestServer struct {
+	*httptest.Server
+	entity *openpgp.Entity
+	mu     sync.Mutex
+	signed []byte
+}
+
+func newReleaseStateTestServer(t *testing.T) *releaseStateTestServer {
+	ts := &releaseStateTestServer{entity: newTestEntity(t)}
+	ts.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/debian/dists/jessie/InRelease" {
+			http.NotFound(w, r)
+			return
+		}
+		ts.mu.Lock()
+		defer ts.mu.Unlock()
+		w.Write(ts.signed)
+	}))
+	return ts
+}
+
+// SetDate replaces the Date field of the served Release and returns the
+// contents of the Release.
+func (ts *releaseStateTestServer) SetDate(t *testing.T, date string) []byte {
+	b, err := ioutil.ReadFile(testReleasePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b = bytes.Replace(b, []byte("Date: Sat, 02 Apr 2016 09:54:11 UTC"), []byte("Date: "+date), 1)
+	signed := clearsignTestData(t, b, ts.entity.PrivateKey)
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	ts.signed = signed
+	return b
+}
+
+func TestClient_FetchRelease_Rollback(t *testing.T) {
+	ts := newReleaseStateTestServer(t)
+	defer ts.Close()
+	dir, err := ioutil.TempDir("", "debrepo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	source := newTestSource(t, ts.URL+"/debian")
+	newClient := func() *Client {
+		c := NewClient(SourceList{source}, openpgp.EntityList{ts.entity}, nil)
+		c.SetCacheDir(dir)
+		return c
+	}
+	c := newClient()
+	if _, ok, err := c.ReleaseState(source); err != nil || ok {
+		t.Fatal("expected no release state")
+	}
+
+	newer := ts.SetDate(t, "Sun, 03 Apr 2016 09:54:11 UTC")
+	if _, err := c.FetchRelease(source); err != nil {
+		t.Fatal(err)
+	}
+	expected := ReleaseState{
+		Date:   time.Date(2016, 4, 3, 9, 54, 11, 0, time.UTC),
+		SHA256: sha256.Sum256(newer),
+	}
+	state, ok, err := c.ReleaseState(source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if actual := state; !ok || !expected.Date.Equal(actual.Date) || expected.SHA256 != actual.SHA256 {
+		t.Fatalf("expected=%v actual=%v", expected, actual)
+	}
+
+	// The state is persisted in the cache directory, so a new client rejects
+	// the older Release as well.
+	ts.SetDate(t, "Sat, 02 Apr 2016 09:54:11 UTC")
+	for i, c := range []*Client{c, newClient()} {
+		_, err := c.FetchRelease(source)
+		staleErr, ok := err.(*StaleReleaseError)
+		if !ok {
+			t.Fatalf("test(%v): expected=*StaleReleaseError actual=%v", i, err)
+		}
+		if !staleErr.LastDate.Equal(expected.Date) {
+			t.Fatalf("test(%v): expected=%v actual=%v", i, expected.Date, staleErr.LastDate)
+		}
+		if state, _, _ := c.ReleaseState(source); !state.Date.Equal(expected.Date) {
+			t.Fatalf("test(%v): expected=%v actual=%v", i, expected.Date, state.Date)
+		}
+	}
+
+	// The same or a newer Release is accepted.
+	ts.SetDate(t, "Sun, 03 Apr 2016 09:54:11 UTC")
+	if _, err := newClient().FetchRelease(source); err != nil {
+		t.Fatal(err)
+	}
+
+	// A different Release with the same Date is rejected.
+	ts.SetDate(t, "Sun, 03 Apr 2016 09:54:11 UTC\nX-Changed: yes")
+	if _, err := newClient().FetchRelease(source); err != ConflictingRelease {
+		t.Fatalf("expected=%v actual=%v", ConflictingRelease, err)
+	}
+	ts.SetDate(t, "Mon, 04 Apr 2016 09:54:11 UTC\nX-Changed: yes")
+	if _, err := newClient().FetchRelease(source); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestClient_SetReleaseState(t *testing.T) {
+	ts := newReleaseStateTestServer(t)
+	defer ts.Close()
+	source := newTestSource(t, ts.URL+"/debian")
+	c := NewClient(SourceList{source}, openpgp.EntityList{ts.entity}, nil)
+
+	state := ReleaseState{Date: time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC)}
+	if err := c.SetReleaseState(source, state); err != nil {
+		t.Fatal(err)
+	}
+	if actual, ok, err := c.ReleaseState(source); err != nil || !ok || !reflect.DeepEqual(state, actual) {
+		t.Fatalf("expected=%v actual=%v", state, actual)
+	}
+	ts.SetDate(t, "Sat, 02 Apr 2016 09:54:11 UTC")
+	if _, err := c.FetchRelease(source); err == nil {
+		t.Fatal("expected error for release older than the recorded state")
+	}
+}
+
+func TestClient_FetchRelease_CorruptState(t *testing.T) {
+	ts := newReleaseStateTestServer(t)
+	defer ts.Close()
+	dir, err := ioutil.TempDir("", "debrepo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	source := newTestSource(t, ts.URL+"/debian")
+	c := NewClient(SourceList{source}, openpgp.EntityList{ts.entity}, nil)
+	c.SetCacheDir(dir)
+	key, err := source.URL("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := c.cache.releaseStatePath(key)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(path, []byte("Date: yesterday\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, err := c.ReleaseState(source); err == nil {
+		t.Fatal("expected error for corrupt release state")
+	}
+	if _, err := c.FetchRelease(source); err == nil {
+		t.Fatal("expected error for corrupt release state")
+	}
+}
+
+func TestClient_FetchRelease_Expired(t *testing.T) {
+	ts := newReleaseStateTestServer(t)
+	defer ts.Close()
+	ts.SetDate(t, "Sat, 02 Apr 2016 09:54:11 UTC\nValid-Until: Sun, 03 Apr 2016 09:54:11 UTC")
+	source := newTestSource(t, ts.URL+"/debian")
+	c := NewClient(SourceList{source}, openpgp.EntityList{ts.entity}, nil)
+	_, err := c.FetchRelease(source)
+	staleErr, ok := err.(*StaleReleaseError)
+	if !ok {
+		t.Fatalf("expected=*StaleReleaseError actual=%v", err)
+	}
+	if expected, actual := time.Date(2016, 4, 3, 9, 54, 11, 0, time.UTC), staleErr.ValidUntil; !expected.Equal(actual) {
+		t.Fatalf("expected=%v actual=%v", expected, actual)
+	}
+	if _, ok, _ := c.ReleaseState(source); ok {
+		t.Fatal("expected no release state for expired release")
+	}
+}
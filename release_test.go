@@ -1,6 +1,7 @@
 package debrepo
 
 import (
+	"crypto"
 	"testing"
 	"time"
 )
@@ -122,6 +123,17 @@ func TestReleaseValidator_ValidateDate(t *testing.T) {
 	if expected, actual := false, rv.err != nil; expected != actual {
 		t.Fatalf("valid date: expected=%v actual=%v", expected, actual)
 	}
+	rv = &releaseValidator{Release: &Release{}, validity: ValidityPolicy{ClockSkew: time.Minute}}
+	rv.Date = time.Now().Add(30 * time.Second)
+	rv.validateDate()
+	if expected, actual := error(nil), rv.err; expected != actual {
+		t.Fatalf("tolerated skew: expected=%v actual=%v", expected, actual)
+	}
+	rv.Date = time.Now().Add(time.Hour)
+	rv.validateDate()
+	if expected, actual := FutureRelease, rv.err; expected != actual {
+		t.Fatalf("future date: expected=%v actual=%v", expected, actual)
+	}
 }
 
 func TestReleaseValidator_ValidateValidUntil(t *testing.T) {
@@ -134,12 +146,15 @@ func TestReleaseValidator_ValidateValidUntil(t *testing.T) {
 		{time.Now().Add(30 * time.Minute), true},
 	}
 	for i, v := range tests {
-		rv := &releaseValidator{Release: &Release{}}
+		rv := &releaseValidator{Release: &Release{}, checkValidUntil: true}
 		rv.ValidUntil = v.time
 		rv.validateValidUntil()
 		if expected, actual := v.valid, rv.err == nil; expected != actual {
 			t.Fatalf("test(%v): expected=%v actual=%v", i, expected, actual)
 		}
+		if _, ok := rv.err.(*StaleReleaseError); !v.valid && !ok {
+			t.Fatalf("test(%v): expected=*StaleReleaseError actual=%v", i, rv.err)
+		}
 	}
 }
 
@@ -155,6 +170,8 @@ func TestReleaseValidator_ValidateFileSums(t *testing.T) {
 		{&Release{MD5Sum: map[string]MD5FileMetaData{"": MD5FileMetaData{}}}, false},
 		{&Release{SHA1: map[string]SHA1FileMetaData{"": SHA1FileMetaData{}}}, false},
 		{&Release{SHA256: map[string]SHA256FileMetaData{"": SHA256FileMetaData{}}}, false},
+		{&Release{SHA512: map[string]SHA512FileMetaData{"": SHA512FileMetaData{}}}, false},
+		{&Release{SHA512: map[string]SHA512FileMetaData{"main/binary-all/Packages": SHA512FileMetaData{}}}, true},
 		{&Release{MD5Sum: map[string]MD5FileMetaData{"main/binary-all/Packages": MD5FileMetaData{}}}, true},
 	}
 	for i, v := range tests {
@@ -184,3 +201,31 @@ func TestReleaseValidator_ValidateAutomatic(t *testing.T) {
 		}
 	}
 }
+
+func TestRelease_Checksum_PrefersStrongest(t *testing.T) {
+	const path = "main/binary-amd64/Packages"
+	r := &Release{
+		MD5Sum: map[string]MD5FileMetaData{path: {Length: 1}},
+		SHA1:   map[string]SHA1FileMetaData{path: {Length: 1}},
+		SHA256: map[string]SHA256FileMetaData{path: {Length: 1}},
+		SHA512: map[string]SHA512FileMetaData{path: {Length: 1}},
+	}
+	expected := []crypto.Hash{crypto.SHA512, crypto.SHA256, crypto.SHA1, crypto.MD5}
+	for i, h := range expected {
+		sum, ok := r.checksum(path)
+		if !ok {
+			t.Fatalf("test(%v): checksum not found", i)
+		}
+		if expected, actual := h, sum.Hash; expected != actual {
+			t.Fatalf("test(%v): expected=%v actual=%v", i, expected, actual)
+		}
+		switch h {
+		case crypto.SHA512:
+			r.SHA512 = nil
+		case crypto.SHA256:
+			r.SHA256 = nil
+		case crypto.SHA1:
+			r.SHA1 = nil
+		}
+	}
+}
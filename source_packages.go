@@ -0,0 +1,127 @@
+package debrepo
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+)
+
+// A SourcePackage is an entry in a source package index. It is decoded from
+// the Sources file present at "dists/$DIST/$COMP/source/Sources".
+// See https://wiki.debian.org/DebianRepository/Format#A.22Sources.22_Indices
+//
+// Multiline values are stored with lines separated by "\n" and without the
+// leading space of continuation lines.
+type SourcePackage struct {
+	Package string
+	// Binary lists the names of the binary packages built from the source
+	// package.
+	Binary       []string
+	Version      string
+	Maintainer   string
+	Uploaders    string
+	Architecture string
+	Section      string
+	Priority     string
+	Format       string
+	Homepage     string
+	Testsuite    string
+
+	StandardsVersion string
+
+	// Relationship fields to the packages needed to build the package.
+	BuildDepends        string
+	BuildDependsIndep   string
+	BuildDependsArch    string
+	BuildConflicts      string
+	BuildConflictsIndep string
+	BuildConflictsArch  string
+
+	// VcsBrowser is the URL of a web interface to the packaging repository.
+	// VcsType is the version control system of the repository, such as "Git"
+	// from the field Vcs-Git, and VcsURL its location.
+	VcsBrowser string
+	VcsType    string
+	VcsURL     string
+
+	// PackageList describes the binary packages built from the source
+	// package.
+	PackageList []PackageListEntry
+
+	// Directory is the location in the repository pool of the files which
+	// make up the source package, listed in Files.
+	Directory string
+	Files     []SourceFile
+
+	// Extra contains the fields of the entry which are not represented
+	// above, keyed by field name.
+	Extra map[string]string
+}
+
+// A SourceFile is a file of a source package. Its checksums are collected
+// from the Files, Checksums-Sha1 and Checksums-Sha256 fields. Checksums which
+// are not listed are zero.
+type SourceFile struct {
+	Name   string
+	Size   int64
+	MD5Sum [md5.Size]byte
+	SHA1   [sha1.Size]byte
+	SHA256 [sha256.Size]byte
+}
+
+// A PackageListEntry is an entry of the Package-List field of a source
+// package, such as:
+//
+//	bash deb shells required arch=any essential=yes
+type PackageListEntry struct {
+	Package  string
+	Type     string
+	Section  string
+	Priority string
+	// Options holds the trailing key=value pairs, such as "arch".
+	Options map[string]string
+}
+
+// A SourceIndex maps binary packages to the source packages they are built
+// from.
+type SourceIndex struct {
+	bySource map[string][]*SourcePackage
+	byBinary map[string][]*SourcePackage
+}
+
+// NewSourceIndex returns a SourceIndex of the source packages in packages,
+// usually read from the Sources indices of a distribution.
+func NewSourceIndex(packages []*SourcePackage) *SourceIndex {
+	si := &SourceIndex{
+		bySource: make(map[string][]*SourcePackage),
+		byBinary: make(map[string][]*SourcePackage),
+	}
+	for _, p := range packages {
+		si.bySource[p.Package] = append(si.bySource[p.Package], p)
+		for _, binary := range p.Binary {
+			si.byBinary[binary] = append(si.byBinary[binary], p)
+		}
+	}
+	return si
+}
+
+// Binary returns the source packages which list the binary package name in
+// their Binary field. An index may hold several versions of a source package.
+func (si *SourceIndex) Binary(name string) []*SourcePackage {
+	return si.byBinary[name]
+}
+
+// SourceOf returns the source package the binary package p was built from,
+// as identified by its Source and Version fields.
+func (si *SourceIndex) SourceOf(p *Package) (*SourcePackage, bool) {
+	name, version := p.SourceNameVersion()
+	for _, sp := range si.bySource[name] {
+		if sp.Version == version {
+			return sp, true
+		}
+		if c, err := CompareVersions(sp.Version, version); err == nil && c == 0 {
+			return sp, true
+		}
+	}
+	return nil, false
+}
@@ -0,0 +1,194 @@
+package debrepo
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+const (
+	// InvalidSourcePackageEntry is returned on malformed Sources entries.
+	InvalidSourcePackageEntry = Error("unable to parse source package entry")
+)
+
+// A SourcePackageReader reads SourcePackage entries from a Sources index.
+type SourcePackageReader struct {
+	pr *ParagraphReader
+}
+
+// NewSourcePackageReader returns a SourcePackageReader reading from r. The
+// index is read one entry at a time, so r may be the uncompressed stream of a
+// large Sources file.
+func NewSourcePackageReader(r io.Reader) *SourcePackageReader {
+	return &SourcePackageReader{pr: NewParagraphReader(r)}
+}
+
+// Read returns the next SourcePackage in the index. io.EOF is returned when
+// there are no more entries.
+func (sr *SourcePackageReader) Read() (*SourcePackage, error) {
+	paragraph, err := sr.pr.Read()
+	if err != nil {
+		return nil, err
+	}
+	return parseSourcePackage(paragraph)
+}
+
+// ReadSourcePackages returns all SourcePackage entries of a Sources index.
+func ReadSourcePackages(r io.Reader) ([]*SourcePackage, error) {
+	var packages []*SourcePackage
+	sr := NewSourcePackageReader(r)
+	for {
+		p, err := sr.Read()
+		if err == io.EOF {
+			return packages, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		packages = append(packages, p)
+	}
+}
+
+func parseSourcePackage(paragraph Paragraph) (*SourcePackage, error) {
+	p := &SourcePackage{}
+	var err error
+	for _, f := range paragraph {
+		name := strings.ToLower(f.Name)
+		switch name {
+		case "package":
+			p.Package = f.Value
+		case "binary":
+			p.Binary = splitCommaList(f.Value)
+		case "version":
+			p.Version = f.Value
+		case "maintainer":
+			p.Maintainer = f.Value
+		case "uploaders":
+			p.Uploaders = f.Value
+		case "architecture":
+			p.Architecture = f.Value
+		case "section":
+			p.Section = f.Value
+		case "priority":
+			p.Priority = f.Value
+		case "format":
+			p.Format = f.Value
+		case "homepage":
+			p.Homepage = f.Value
+		case "testsuite":
+			p.Testsuite = f.Value
+		case "standards-version":
+			p.StandardsVersion = f.Value
+		case "build-depends":
+			p.BuildDepends = f.Value
+		case "build-depends-indep":
+			p.BuildDependsIndep = f.Value
+		case "build-depends-arch":
+			p.BuildDependsArch = f.Value
+		case "build-conflicts":
+			p.BuildConflicts = f.Value
+		case "build-conflicts-indep":
+			p.BuildConflictsIndep = f.Value
+		case "build-conflicts-arch":
+			p.BuildConflictsArch = f.Value
+		case "vcs-browser":
+			p.VcsBrowser = f.Value
+		case "vcs-arch", "vcs-bzr", "vcs-cvs", "vcs-darcs", "vcs-git", "vcs-hg", "vcs-mtn", "vcs-svn":
+			p.VcsType, p.VcsURL = f.Name[len("vcs-"):], f.Value
+		case "package-list":
+			p.PackageList, err = parsePackageList(f.Value)
+		case "directory":
+			p.Directory = f.Value
+		case "files", "checksums-sha1", "checksums-sha256":
+			err = p.parseFiles(name, f.Value)
+		default:
+			if p.Extra == nil {
+				p.Extra = make(map[string]string)
+			}
+			p.Extra[f.Name] = f.Value
+		}
+		if err != nil {
+			return nil, fmt.Errorf("source package %s: field %s: %v", p.Package, f.Name, err)
+		}
+	}
+	if len(p.Package) == 0 {
+		return nil, InvalidSourcePackageEntry
+	}
+	return p, nil
+}
+
+// splitCommaList splits a comma separated list, such as the Binary field.
+func splitCommaList(value string) []string {
+	var list []string
+	for _, s := range strings.Split(value, ",") {
+		if s = strings.TrimSpace(s); len(s) > 0 {
+			list = append(list, s)
+		}
+	}
+	return list
+}
+
+// parseFiles adds the checksums of the multiline field name to the files of
+// the source package.
+func (p *SourcePackage) parseFiles(name, value string) error {
+	for _, line := range fileSumLines(value) {
+		words := strings.Fields(line)
+		if len(words) != 3 {
+			return fmt.Errorf("invalid file checksum line: %s", line)
+		}
+		size, err := strconv.ParseInt(words[1], 10, 64)
+		if err != nil {
+			return err
+		}
+		f := p.file(words[2])
+		f.Size = size
+		switch name {
+		case "files":
+			err = decodeHexSum(f.MD5Sum[:], words[0])
+		case "checksums-sha1":
+			err = decodeHexSum(f.SHA1[:], words[0])
+		case "checksums-sha256":
+			err = decodeHexSum(f.SHA256[:], words[0])
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// file returns the file of the source package named name, adding it if it is
+// not present.
+func (p *SourcePackage) file(name string) *SourceFile {
+	for i := range p.Files {
+		if p.Files[i].Name == name {
+			return &p.Files[i]
+		}
+	}
+	p.Files = append(p.Files, SourceFile{Name: name})
+	return &p.Files[len(p.Files)-1]
+}
+
+func parsePackageList(value string) ([]PackageListEntry, error) {
+	var entries []PackageListEntry
+	for _, line := range fileSumLines(value) {
+		words := strings.Fields(line)
+		if len(words) < 4 {
+			return nil, fmt.Errorf("invalid package list line: %s", line)
+		}
+		e := PackageListEntry{Package: words[0], Type: words[1], Section: words[2], Priority: words[3]}
+		for _, option := range words[4:] {
+			i := strings.Index(option, "=")
+			if i <= 0 {
+				return nil, fmt.Errorf("invalid package list option: %s", option)
+			}
+			if e.Options == nil {
+				e.Options = make(map[string]string)
+			}
+			e.Options[option[:i]] = option[i+1:]
+		}
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
@@ -0,0 +1,138 @@
+package debrepo
+
+import (
+	"encoding/hex"
+	"io"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func readTestSourcePackages(t *testing.T) []*SourcePackage {
+	f, err := os.Open("testdata/packages/Sources")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	packages, err := ReadSourcePackages(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return packages
+}
+
+func TestSourcePackageReader_Read(t *testing.T) {
+	packages := readTestSourcePackages(t)
+	if expected, actual := 3, len(packages); expected != actual {
+		t.Fatalf("expected=%v actual=%v", expected, actual)
+	}
+
+	bash := packages[1]
+	checkField := func(field, expected, actual string) {
+		if expected != actual {
+			t.Fatalf("%s: expected=%q actual=%q", field, expected, actual)
+		}
+	}
+	checkField("Package", "bash", bash.Package)
+	checkField("Version", "4.3-11", bash.Version)
+	checkField("Directory", "pool/main/b/bash", bash.Directory)
+	checkField("BuildDependsIndep", "texlive-latex-base, ghostscript, texlive-fonts-recommended, man2html-base", bash.BuildDependsIndep)
+	checkField("BuildConflicts", "r-base-core", bash.BuildConflicts)
+	checkField("Format", "3.0 (quilt)", bash.Format)
+	if expected, actual := []string{"bash", "bash-static", "bash-builtins", "bash-doc"}, bash.Binary; !reflect.DeepEqual(expected, actual) {
+		t.Fatalf("Binary: expected=%v actual=%v", expected, actual)
+	}
+
+	if expected, actual := 3, len(bash.Files); expected != actual {
+		t.Fatalf("Files: expected=%v actual=%v", expected, actual)
+	}
+	orig := bash.Files[1]
+	checkField("Name", "bash_4.3.orig.tar.xz", orig.Name)
+	checkField("MD5Sum", "4a1f9e8d7c6b5a4f3e2d1c0b9a8f7e6d", hex.EncodeToString(orig.MD5Sum[:]))
+	checkField("SHA1", "2b3c4d5e6f708192a3b4c5d6e7f8091a2b3c4d5e", hex.EncodeToString(orig.SHA1[:]))
+	checkField("SHA256", "9b2d5f3a4c6e7b8d9f0a1b2c3d4e5f6a7b8c9d0e1f2a3b4c5d6e7f8091a2b3c4", hex.EncodeToString(orig.SHA256[:]))
+	if expected, actual := int64(3391700), orig.Size; expected != actual {
+		t.Fatalf("Size: expected=%v actual=%v", expected, actual)
+	}
+
+	expected := PackageListEntry{
+		Package:  "bash",
+		Type:     "deb",
+		Section:  "shells",
+		Priority: "required",
+		Options:  map[string]string{"arch": "any", "essential": "yes"},
+	}
+	if actual := bash.PackageList[0]; !reflect.DeepEqual(expected, actual) {
+		t.Fatalf("PackageList: expected=%v actual=%v", expected, actual)
+	}
+
+	ad := packages[0]
+	checkField("VcsType", "Svn", ad.VcsType)
+	checkField("VcsURL", "svn://anonscm.debian.org/pkg-games/packages/trunk/0ad/", ad.VcsURL)
+	checkField("VcsBrowser", "http://anonscm.debian.org/viewvc/pkg-games/packages/trunk/0ad/", ad.VcsBrowser)
+	checkField("StandardsVersion", "3.9.6", ad.StandardsVersion)
+}
+
+func TestSourcePackageReader_Invalid(t *testing.T) {
+	tests := []string{
+		"Binary: bash\nVersion: 4.3-11\n",
+		"Package: bash\nFiles:\n 2b7a5e1c9d8f7e6a5b4c3d2e1f0a9b8c 2224\n",
+		"Package: bash\nFiles:\n 2b7a 2224 bash_4.3-11.dsc\n",
+		"Package: bash\nChecksums-Sha256:\n 2b7a5e1c9d8f7e6a5b4c3d2e1f0a9b8c 2224 bash_4.3-11.dsc\n",
+		"Package: bash\nPackage-List:\n bash deb shells\n",
+		"Package: bash\nPackage-List:\n bash deb shells required arch\n",
+	}
+	for i, tt := range tests {
+		if _, err := NewSourcePackageReader(strings.NewReader(tt)).Read(); err == nil {
+			t.Fatalf("test(%v): expected error", i)
+		}
+	}
+	if _, err := NewSourcePackageReader(strings.NewReader("")).Read(); err != io.EOF {
+		t.Fatalf("expected=%v actual=%v", io.EOF, err)
+	}
+}
+
+func TestSourceIndex(t *testing.T) {
+	si := NewSourceIndex(readTestSourcePackages(t))
+	if sources := si.Binary("libc-bin"); len(sources) != 1 || sources[0].Package != "glibc" {
+		t.Fatalf("unexpected sources of libc-bin: %v", sources)
+	}
+	if sources := si.Binary("zsh"); len(sources) != 0 {
+		t.Fatalf("unexpected sources of zsh: %v", sources)
+	}
+
+	f, err := os.Open("testdata/packages/Packages")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	packages, err := ReadPackages(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		source, version string
+	}{
+		{"0ad", "0.0.17-1"},         // no Source field
+		{"bash", "4.3-11"},          // binNMU with source version
+		{"glibc", "2.19-18+deb8u4"}, // source name only
+	}
+	for i, tt := range tests {
+		name, version := packages[i].SourceNameVersion()
+		if expected, actual := tt.source+" "+tt.version, name+" "+version; expected != actual {
+			t.Fatalf("test(%v): expected=%v actual=%v", i, expected, actual)
+		}
+		sp, ok := si.SourceOf(packages[i])
+		if !ok {
+			t.Fatalf("test(%v): source package not found", i)
+		}
+		if expected, actual := tt.source, sp.Package; expected != actual {
+			t.Fatalf("test(%v): expected=%v actual=%v", i, expected, actual)
+		}
+	}
+
+	if _, ok := si.SourceOf(&Package{Package: "bash", Source: "bash (5.0-4)"}); ok {
+		t.Fatal("expected no source package for unknown version")
+	}
+}
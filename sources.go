@@ -1,7 +1,12 @@
 package debrepo
 
 import (
+	"bufio"
 	"fmt"
+	"io"
+	"net/url"
+	"path"
+	"reflect"
 	"strings"
 
 	"github.com/asaskevich/govalidator"
@@ -16,49 +21,399 @@ const (
 // the control file "sources.list".
 type Source struct {
 	repoType     string
+	options      []SourceOption
 	baseURI      string
 	distribution string
 	components   []string
 }
 
+// A SourceOption is an entry of the options block of a Source, such as
+// "arch=amd64,i386" in:
+//
+//	deb [arch=amd64,i386] http://ftp.debian.org/debian jessie main
+type SourceOption struct {
+	Name string
+	// Operator is "=", or "+=" and "-=" to add values to or remove values
+	// from the default of a multivalue option.
+	Operator string
+	Values   []string
+}
+
+func (o SourceOption) String() string {
+	return o.Name + o.Operator + strings.Join(o.Values, ",")
+}
+
+// valid reports whether o has a name, a known operator and at least one
+// value.
+func (o SourceOption) valid() bool {
+	if len(o.Name) == 0 || strings.ContainsAny(o.Name, " \t=[]") ||
+		strings.HasSuffix(o.Name, "+") || strings.HasSuffix(o.Name, "-") {
+		return false
+	}
+	switch o.Operator {
+	case "=", "+=", "-=":
+	default:
+		return false
+	}
+	if len(o.Values) == 0 {
+		return false
+	}
+	for _, v := range o.Values {
+		if len(v) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
 func (s Source) String() string {
-	if len(s.components) == 0 {
+	if len(s.components) == 0 && !s.IsFlat() {
 		return ""
 	}
-	return fmt.Sprintf("%s %s %s %s",
-		s.repoType,
-		s.baseURI,
-		s.distribution,
-		strings.Join(s.components, " "))
+	fields := []string{s.repoType}
+	if len(s.options) > 0 {
+		options := make([]string, 0, len(s.options))
+		for _, o := range s.options {
+			options = append(options, o.String())
+		}
+		fields = append(fields, "["+strings.Join(options, " ")+"]")
+	}
+	fields = append(fields, s.baseURI, s.distribution)
+	fields = append(fields, s.components...)
+	return strings.Join(fields, " ")
 }
 
 // ParseSource parses entry to create a Source.
 // entry must be in the format:
-// 	deb http://ftp.debian.org/debian squeeze main contrib non-free
+//
+//	deb [option=value ...] http://ftp.debian.org/debian squeeze main contrib non-free
+//
+// The options block is optional. A flat repository is referenced by an exact
+// path ending in "/" in place of the distribution and has no components:
+//
+//	deb http://example.org/debian ./
+//
+// See https://manpages.debian.org/sources.list
 func ParseSource(entry string) (*Source, error) {
-	ss := strings.Split(entry, " ")
-	if len(ss) < 4 {
+	entry = strings.TrimSpace(entry)
+	i := strings.IndexAny(entry, " \t")
+	if i == -1 {
 		return nil, InvalidSourceEntry
 	}
-	for _, f := range ss {
-		if len(f) == 0 {
+	repoType, rest := entry[:i], strings.TrimSpace(entry[i:])
+	var options []SourceOption
+	if strings.HasPrefix(rest, "[") {
+		end := strings.Index(rest, "]")
+		if end == -1 {
 			return nil, InvalidSourceEntry
 		}
+		var err error
+		if options, err = parseSourceOptions(rest[1:end]); err != nil {
+			return nil, err
+		}
+		rest = rest[end+1:]
 	}
-	if ss[0] != "deb" && ss[0] != "deb-src" {
+	ss := strings.Fields(rest)
+	if len(ss) < 2 {
 		return nil, InvalidSourceEntry
 	}
-	if !govalidator.IsURL(ss[1]) {
+	return newSource(repoType, options, ss[0], ss[1], ss[2:])
+}
+
+// NewSource returns a Source of type repoType, "deb" or "deb-src", for the
+// repository at uri. suite is the distribution, or the exact path ending in
+// "/" of a flat repository, in which case components must be empty.
+// InvalidSourceEntry is returned if any of the fields are invalid.
+func NewSource(repoType, uri, suite string, components []string, options ...SourceOption) (*Source, error) {
+	source, err := newSource(repoType, options, uri, suite, components)
+	if err != nil {
+		return nil, err
+	}
+	// Copy the caller's slices so that later changes do not affect the Source.
+	return source.Clone(), nil
+}
+
+// newSource returns a Source after validating its fields.
+func newSource(repoType string, options []SourceOption, baseURI, distribution string, components []string) (*Source, error) {
+	if repoType != "deb" && repoType != "deb-src" {
 		return nil, InvalidSourceEntry
 	}
+	if !validSourceURI(baseURI) {
+		return nil, InvalidSourceEntry
+	}
+	for _, o := range options {
+		if !o.valid() {
+			return nil, InvalidSourceEntry
+		}
+	}
+	if len(options) == 0 {
+		options = nil
+	}
+	if len(distribution) == 0 {
+		return nil, InvalidSourceEntry
+	}
+	// An exact path must not be followed by components, and components are
+	// required otherwise.
+	if strings.HasSuffix(distribution, "/") != (len(components) == 0) {
+		return nil, InvalidSourceEntry
+	}
+	if len(components) == 0 {
+		components = nil
+	}
 	return &Source{
-		repoType:     ss[0],
-		baseURI:      ss[1],
-		distribution: ss[2],
-		components:   ss[3:],
+		repoType:     repoType,
+		options:      options,
+		baseURI:      baseURI,
+		distribution: distribution,
+		components:   components,
 	}, nil
 }
 
+// validSourceURI reports whether uri is an absolute URI which can be used as
+// the base URI of a repository. "file" and "copy" URIs must contain an
+// absolute path, while URIs of other schemes require a host or an absolute
+// path. HTTP URIs are validated strictly.
+func validSourceURI(uri string) bool {
+	u, err := url.Parse(uri)
+	if err != nil || len(u.Scheme) == 0 {
+		return false
+	}
+	switch strings.ToLower(u.Scheme) {
+	case "http", "https":
+		return govalidator.IsURL(uri)
+	case "file", "copy":
+		return len(u.Host) == 0 && path.IsAbs(u.Path)
+	}
+	return len(u.Host) > 0 || path.IsAbs(u.Path)
+}
+
+// parseSourceOptions parses the contents of a Source options block.
+func parseSourceOptions(block string) ([]SourceOption, error) {
+	var options []SourceOption
+	for _, f := range strings.Fields(block) {
+		i := strings.Index(f, "=")
+		if i <= 0 || i == len(f)-1 {
+			return nil, InvalidSourceEntry
+		}
+		o := SourceOption{Name: f[:i], Operator: "="}
+		if c := f[i-1]; c == '+' || c == '-' {
+			o.Name, o.Operator = f[:i-1], f[i-1:i+1]
+		}
+		if len(o.Name) == 0 {
+			return nil, InvalidSourceEntry
+		}
+		for _, v := range strings.Split(f[i+1:], ",") {
+			if len(v) == 0 {
+				return nil, InvalidSourceEntry
+			}
+			o.Values = append(o.Values, v)
+		}
+		options = append(options, o)
+	}
+	if len(options) == 0 {
+		return nil, InvalidSourceEntry
+	}
+	return options, nil
+}
+
+// Option returns the option name of the source and whether it is set.
+func (s *Source) Option(name string) (SourceOption, bool) {
+	for _, o := range s.options {
+		if o.Name == name {
+			return o, true
+		}
+	}
+	return SourceOption{}, false
+}
+
+func (s *Source) optionValues(name string) []string {
+	o, _ := s.Option(name)
+	return o.Values
+}
+
+// optionBool returns the value of the boolean option name, or def if it is
+// not set or its value is not recognized.
+func (s *Source) optionBool(name string, def bool) bool {
+	values := s.optionValues(name)
+	if len(values) != 1 {
+		return def
+	}
+	switch strings.ToLower(values[0]) {
+	case "yes", "true", "on", "enable":
+		return true
+	case "no", "false", "off", "disable":
+		return false
+	}
+	return def
+}
+
+// Architectures returns the architectures of the "arch" option. Indices are
+// only downloaded for these architectures. It returns nil if the option is
+// not set.
+func (s *Source) Architectures() []string { return s.optionValues("arch") }
+
+// Languages returns the languages of the "lang" option. It returns nil if the
+// option is not set.
+func (s *Source) Languages() []string { return s.optionValues("lang") }
+
+// Targets returns the index targets of the "target" option. It returns nil if
+// the option is not set.
+func (s *Source) Targets() []string { return s.optionValues("target") }
+
+// SignedBy returns the values of the "signed-by" option. Each value is either
+// the absolute path of a keyring file or a key fingerprint. It returns nil if
+// the option is not set.
+func (s *Source) SignedBy() []string { return s.optionValues("signed-by") }
+
+// SignedByKeyrings returns the keyring file paths of the "signed-by" option.
+func (s *Source) SignedByKeyrings() []string {
+	var keyrings []string
+	for _, v := range s.SignedBy() {
+		if strings.HasPrefix(v, "/") {
+			keyrings = append(keyrings, v)
+		}
+	}
+	return keyrings
+}
+
+// SignedByKeyBlock returns the ASCII armored public key block embedded in the
+// Signed-By field of a deb822 style source, or "" if there is none.
+func (s *Source) SignedByKeyBlock() string {
+	for _, v := range s.SignedBy() {
+		if strings.HasPrefix(v, "-----BEGIN") {
+			return v
+		}
+	}
+	return ""
+}
+
+// SignedByFingerprints returns the key fingerprints of the "signed-by" option.
+// A trailing "!", which requires the exact key rather than any of its
+// subkeys, is ignored.
+func (s *Source) SignedByFingerprints() [][20]byte {
+	var fingerprints [][20]byte
+	for _, v := range s.SignedBy() {
+		var fingerprint [20]byte
+		if err := decodeHexSum(fingerprint[:], strings.TrimSuffix(v, "!")); err != nil {
+			continue
+		}
+		fingerprints = append(fingerprints, fingerprint)
+	}
+	return fingerprints
+}
+
+// Trusted reports whether the "trusted" option is enabled, in which case the
+// repository is used even if it is not signed.
+func (s *Source) Trusted() bool { return s.optionBool("trusted", false) }
+
+// CheckValidUntil reports whether the Valid-Until field of the Release file
+// of the source should be checked. It is true unless disabled by the
+// "check-valid-until" option.
+func (s *Source) CheckValidUntil() bool { return s.optionBool("check-valid-until", true) }
+
+// Type returns the archive type of the source, "deb" or "deb-src".
+func (s *Source) Type() string { return s.repoType }
+
+// URI returns the base URI of the repository.
+func (s *Source) URI() *url.URL {
+	// The URI was validated when the Source was created.
+	u, _ := url.Parse(s.baseURI)
+	return u
+}
+
+// Suite returns the distribution of the source, such as "jessie" or
+// "stable", or the exact path of a flat repository.
+func (s *Source) Suite() string { return s.distribution }
+
+// Components returns the components of the source. It returns nil for a flat
+// repository.
+func (s *Source) Components() []string {
+	if s.components == nil {
+		return nil
+	}
+	return append([]string(nil), s.components...)
+}
+
+// Options returns the options of the source in the order they were given.
+func (s *Source) Options() []SourceOption {
+	if s.options == nil {
+		return nil
+	}
+	options := make([]SourceOption, len(s.options))
+	for i, o := range s.options {
+		o.Values = append([]string(nil), o.Values...)
+		options[i] = o
+	}
+	return options
+}
+
+// Clone returns a copy of s which shares no memory with it.
+func (s *Source) Clone() *Source {
+	c := *s
+	c.components = s.Components()
+	c.options = s.Options()
+	return &c
+}
+
+// Equal reports whether s and o reference the same repository with the same
+// options. Options are compared in order.
+func (s *Source) Equal(o *Source) bool {
+	if s == nil || o == nil {
+		return s == o
+	}
+	return reflect.DeepEqual(s, o)
+}
+
+// IsFlat reports whether the source references a flat repository, whose
+// distribution is an exact path ending in "/" rather than a directory under
+// "dists".
+func (s *Source) IsFlat() bool { return strings.HasSuffix(s.distribution, "/") }
+
 // SourceList is a list of APT data sources. It is equivalent to the file
 // "sources.list" on Debian style Linux distributions.
 type SourceList []*Source
+
+// ReadOneLineSourceList reads a SourceList from a file in the one-line format
+// of "sources.list". Blank lines and comments starting with "#" are ignored.
+// Invalid entries are reported as a *SourceListError.
+func ReadOneLineSourceList(r io.Reader) (SourceList, error) {
+	var sl SourceList
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		line := scanner.Text()
+		if i := strings.Index(line, "#"); i != -1 {
+			line = line[:i]
+		}
+		if len(strings.TrimSpace(line)) == 0 {
+			continue
+		}
+		source, err := ParseSource(line)
+		if err != nil {
+			return nil, &SourceListError{Line: n, Err: err}
+		}
+		sl = append(sl, source)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return sl, nil
+}
+
+// WriteOneLineSourceList writes sl to w in the one-line format of
+// "sources.list".
+func WriteOneLineSourceList(w io.Writer, sl SourceList) error {
+	bw := bufio.NewWriter(w)
+	for _, source := range sl {
+		for _, o := range source.options {
+			for _, v := range o.Values {
+				if strings.ContainsAny(v, " \t\n,]") {
+					return fmt.Errorf("option %s can not be written in one-line format", o.Name)
+				}
+			}
+		}
+		if _, err := fmt.Fprintln(bw, source); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
@@ -0,0 +1,211 @@
+package debrepo
+
+import (
+	"io"
+	"strings"
+)
+
+// sourceOptionFields maps the deb822 field names of source options which do
+// not follow the one-line option name.
+var sourceOptionFields = map[string]string{
+	"arch":              "Architectures",
+	"lang":              "Languages",
+	"target":            "Targets",
+	"pdiffs":            "PDiffs",
+	"inrelease-path":    "InRelease-Path",
+	"signed-by":         "Signed-By",
+	"check-valid-until": "Check-Valid-Until",
+}
+
+// deb822 fields of a source stanza which are not options.
+var sourceStanzaFields = map[string]bool{
+	"types":      true,
+	"uris":       true,
+	"suites":     true,
+	"components": true,
+	"enabled":    true,
+}
+
+// ReadSourceList reads a SourceList from a file in the deb822 format used by
+// "/etc/apt/sources.list.d/*.sources". Each stanza is expanded into a Source
+// for every combination of its Types, URIs and Suites. Stanzas with
+// "Enabled: no" are skipped.
+//
+// A Signed-By field may embed an ASCII armored public key block, which is
+// returned by Source.SignedByKeyBlock.
+//
+// Invalid stanzas are reported as a *SourceListError.
+// See https://manpages.debian.org/sources.list
+func ReadSourceList(r io.Reader) (SourceList, error) {
+	var sl SourceList
+	pr := NewParagraphReader(r)
+	for {
+		p, err := pr.Read()
+		if err == io.EOF {
+			return sl, nil
+		}
+		if err != nil {
+			return nil, &SourceListError{Line: pr.line, Err: err}
+		}
+		sources, err := parseSourceStanza(p)
+		if err != nil {
+			return nil, &SourceListError{Line: pr.start, Err: err}
+		}
+		sl = append(sl, sources...)
+	}
+}
+
+func parseSourceStanza(p Paragraph) (SourceList, error) {
+	if enabled, ok := p.Lookup("Enabled"); ok {
+		switch strings.ToLower(enabled) {
+		case "no", "false":
+			return nil, nil
+		case "yes", "true":
+		default:
+			return nil, InvalidSourceEntry
+		}
+	}
+	var options []SourceOption
+	for _, f := range p {
+		if sourceStanzaFields[strings.ToLower(f.Name)] {
+			continue
+		}
+		o, err := parseSourceStanzaOption(f)
+		if err != nil {
+			return nil, err
+		}
+		options = append(options, o)
+	}
+	types := strings.Fields(p.Get("Types"))
+	uris := strings.Fields(p.Get("URIs"))
+	suites := strings.Fields(p.Get("Suites"))
+	components := strings.Fields(p.Get("Components"))
+	if len(types) == 0 || len(uris) == 0 || len(suites) == 0 {
+		return nil, InvalidSourceEntry
+	}
+	var sl SourceList
+	for _, t := range types {
+		for _, u := range uris {
+			for _, s := range suites {
+				source, err := newSource(t, options, u, s, components)
+				if err != nil {
+					return nil, err
+				}
+				// The options and components are shared by all Sources of
+				// the stanza, so each Source receives its own copy.
+				sl = append(sl, source.Clone())
+			}
+		}
+	}
+	return sl, nil
+}
+
+// parseSourceStanzaOption converts the deb822 field f of a source stanza into
+// the equivalent SourceOption.
+func parseSourceStanzaOption(f Field) (SourceOption, error) {
+	name := strings.ToLower(f.Name)
+	o := SourceOption{Name: name, Operator: "="}
+	switch {
+	case strings.HasSuffix(name, "-add"):
+		o.Name, o.Operator = strings.TrimSuffix(name, "-add"), "+="
+	case strings.HasSuffix(name, "-remove"):
+		o.Name, o.Operator = strings.TrimSuffix(name, "-remove"), "-="
+	}
+	for option, field := range sourceOptionFields {
+		if strings.EqualFold(o.Name, field) {
+			o.Name = option
+		}
+	}
+	if o.Name == "signed-by" && strings.Contains(f.Value, "-----BEGIN") {
+		lines := strings.Split(strings.TrimSpace(f.Value), "\n")
+		for i, line := range lines {
+			if line == "." {
+				lines[i] = ""
+			}
+		}
+		o.Values = []string{strings.Join(lines, "\n")}
+		return o, nil
+	}
+	o.Values = strings.FieldsFunc(f.Value, func(c rune) bool {
+		return c == ',' || c == ' ' || c == '\t' || c == '\n'
+	})
+	if len(o.Values) == 0 {
+		return SourceOption{}, InvalidSourceEntry
+	}
+	return o, nil
+}
+
+// WriteSourceList writes sl to w in the deb822 format used by
+// "/etc/apt/sources.list.d/*.sources". Each Source is written as a separate
+// stanza.
+func WriteSourceList(w io.Writer, sl SourceList) error {
+	pw := NewParagraphWriter(w)
+	for _, source := range sl {
+		p := Paragraph{
+			{"Types", source.repoType},
+			{"URIs", source.baseURI},
+			{"Suites", source.distribution},
+		}
+		if len(source.components) > 0 {
+			p = append(p, Field{"Components", strings.Join(source.components, " ")})
+		}
+		for _, o := range source.options {
+			p = append(p, sourceStanzaOption(o))
+		}
+		if err := pw.Write(p); err != nil {
+			return err
+		}
+	}
+	return pw.Flush()
+}
+
+// sourceStanzaOption converts o into the equivalent deb822 field.
+func sourceStanzaOption(o SourceOption) Field {
+	name, ok := sourceOptionFields[o.Name]
+	if !ok {
+		parts := strings.Split(o.Name, "-")
+		for i, part := range parts {
+			if len(part) > 0 {
+				parts[i] = strings.ToUpper(part[:1]) + part[1:]
+			}
+		}
+		name = strings.Join(parts, "-")
+	}
+	switch o.Operator {
+	case "+=":
+		name += "-Add"
+	case "-=":
+		name += "-Remove"
+	}
+	if len(o.Values) == 1 && strings.Contains(o.Values[0], "\n") {
+		lines := strings.Split(o.Values[0], "\n")
+		for i, line := range lines {
+			if len(strings.TrimSpace(line)) == 0 {
+				lines[i] = "."
+			}
+		}
+		return Field{name, "\n" + strings.Join(lines, "\n")}
+	}
+	return Field{name, strings.Join(o.Values, " ")}
+}
+
+// ConvertToDeb822 reads a source list in the one-line format from r and
+// writes it to w in the deb822 format.
+func ConvertToDeb822(w io.Writer, r io.Reader) error {
+	sl, err := ReadOneLineSourceList(r)
+	if err != nil {
+		return err
+	}
+	return WriteSourceList(w, sl)
+}
+
+// ConvertToOneLine reads a source list in the deb822 format from r and writes
+// it to w in the one-line format. An error is returned if a source embeds a
+// Signed-By key block, which can not be represented in the one-line format.
+func ConvertToOneLine(w io.Writer, r io.Reader) error {
+	sl, err := ReadSourceList(r)
+	if err != nil {
+		return err
+	}
+	return WriteOneLineSourceList(w, sl)
+}
@@ -0,0 +1,178 @@
+package debrepo
+
+import (
+	"bytes"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func readTestSourceList(t *testing.T, path string) SourceList {
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	sl, err := ReadSourceList(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return sl
+}
+
+func sourceListStrings(sl SourceList) []string {
+	ss := make([]string, 0, len(sl))
+	for _, s := range sl {
+		ss = append(ss, s.String())
+	}
+	return ss
+}
+
+func TestReadSourceList(t *testing.T) {
+	sl := readTestSourceList(t, "testdata/sources/debian.sources")
+	expected := []string{
+		"deb [signed-by=/usr/share/keyrings/debian-archive-keyring.gpg] https://deb.debian.org/debian bookworm main non-free-firmware",
+		"deb [signed-by=/usr/share/keyrings/debian-archive-keyring.gpg] https://deb.debian.org/debian bookworm-updates main non-free-firmware",
+		"deb-src [signed-by=/usr/share/keyrings/debian-archive-keyring.gpg] https://deb.debian.org/debian bookworm main non-free-firmware",
+		"deb-src [signed-by=/usr/share/keyrings/debian-archive-keyring.gpg] https://deb.debian.org/debian bookworm-updates main non-free-firmware",
+	}
+	if actual := sourceListStrings(sl[:4]); !reflect.DeepEqual(expected, actual) {
+		t.Fatalf("expected=%q actual=%q", expected, actual)
+	}
+	if expected, actual := 5, len(sl); expected != actual {
+		t.Fatalf("expected=%v actual=%v", expected, actual)
+	}
+	vendor := sl[4]
+	if expected, actual := []string{"amd64", "arm64"}, vendor.Architectures(); !reflect.DeepEqual(expected, actual) {
+		t.Fatalf("expected=%v actual=%v", expected, actual)
+	}
+	if vendor.CheckValidUntil() {
+		t.Fatal("expected check-valid-until to be disabled")
+	}
+	key := vendor.SignedByKeyBlock()
+	if !strings.HasPrefix(key, "-----BEGIN PGP PUBLIC KEY BLOCK-----\n\nmDMEZ") ||
+		!strings.HasSuffix(key, "-----END PGP PUBLIC KEY BLOCK-----") {
+		t.Fatalf("unexpected key block: %q", key)
+	}
+	if len(vendor.SignedByKeyrings()) != 0 || len(vendor.SignedByFingerprints()) != 0 {
+		t.Fatal("expected no keyring paths or fingerprints")
+	}
+
+	sl = readTestSourceList(t, "testdata/sources/ubuntu.sources")
+	if expected, actual := 5, len(sl); expected != actual {
+		t.Fatalf("expected=%v actual=%v", expected, actual)
+	}
+	if !sl[4].IsFlat() {
+		t.Fatalf("expected flat repository: %v", sl[4])
+	}
+}
+
+func TestReadSourceList_Invalid(t *testing.T) {
+	tests := []string{
+		"URIs: http://ftp.debian.org/debian\nSuites: jessie\nComponents: main",
+		"Types: deb\nSuites: jessie\nComponents: main",
+		"Types: deb\nURIs: http://ftp.debian.org/debian\nComponents: main",
+		"Types: deb\nURIs: http://ftp.debian.org/debian\nSuites: jessie",
+		"Types: rpm\nURIs: http://ftp.debian.org/debian\nSuites: jessie\nComponents: main",
+		"Types: deb\nURIs: #notURL\nSuites: jessie\nComponents: main",
+		"Types: deb\nURIs: http://ftp.debian.org/debian\nSuites: jessie\nComponents: main\nEnabled: maybe",
+		"Types: deb\nURIs: http://ftp.debian.org/debian\nSuites: jessie\nComponents: main\nArchitectures:",
+		"Types: deb\nURIs: http://example.org/debian\nSuites: ./\nComponents: main",
+	}
+	for i, tt := range tests {
+		_, err := ReadSourceList(strings.NewReader("# comment\n\n" + tt))
+		serr, ok := err.(*SourceListError)
+		if !ok {
+			t.Fatalf("test(%v): expected *SourceListError, got %v", i, err)
+		}
+		if expected, actual := InvalidSourceEntry, serr.Err; expected != actual {
+			t.Fatalf("test(%v): expected=%v actual=%v", i, expected, actual)
+		}
+		if expected, actual := 3, serr.Line; expected != actual {
+			t.Fatalf("test(%v): line: expected=%v actual=%v", i, expected, actual)
+		}
+	}
+}
+
+func TestReadSourceList_StanzaSharesNoMemory(t *testing.T) {
+	sl, err := ReadSourceList(strings.NewReader("Types: deb deb-src\nURIs: http://ftp.debian.org/debian\n" +
+		"Suites: jessie\nComponents: main contrib\nArchitectures: amd64 i386\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected, actual := 2, len(sl); expected != actual {
+		t.Fatalf("expected=%v actual=%v", expected, actual)
+	}
+	sl[0].options[0].Values[0] = "arm64"
+	sl[0].options = append(sl[0].options[:0], SourceOption{Name: "trusted", Operator: "=", Values: []string{"yes"}})
+	sl[0].components[0] = "non-free"
+	if expected, actual := []string{"amd64", "i386"}, sl[1].Architectures(); !reflect.DeepEqual(expected, actual) {
+		t.Fatalf("expected=%v actual=%v", expected, actual)
+	}
+	if expected, actual := []string{"main", "contrib"}, sl[1].Components(); !reflect.DeepEqual(expected, actual) {
+		t.Fatalf("expected=%v actual=%v", expected, actual)
+	}
+}
+
+func TestWriteSourceList_RoundTrip(t *testing.T) {
+	sl := readTestSourceList(t, "testdata/sources/debian.sources")
+	var buf bytes.Buffer
+	if err := WriteSourceList(&buf, sl); err != nil {
+		t.Fatal(err)
+	}
+	actual, err := ReadSourceList(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(sl, actual) {
+		t.Fatalf("expected=%q actual=%q", sourceListStrings(sl), sourceListStrings(actual))
+	}
+}
+
+func TestConvertToDeb822(t *testing.T) {
+	oneLine := "# Debian\n" +
+		"deb [arch+=i386 check-valid-until=no] http://ftp.debian.org/debian jessie main contrib # main archive\n" +
+		"\n" +
+		"deb-src http://ftp.debian.org/debian jessie main\n"
+	expected := "Types: deb\n" +
+		"URIs: http://ftp.debian.org/debian\n" +
+		"Suites: jessie\n" +
+		"Components: main contrib\n" +
+		"Architectures-Add: i386\n" +
+		"Check-Valid-Until: no\n" +
+		"\n" +
+		"Types: deb-src\n" +
+		"URIs: http://ftp.debian.org/debian\n" +
+		"Suites: jessie\n" +
+		"Components: main\n"
+	var buf bytes.Buffer
+	if err := ConvertToDeb822(&buf, strings.NewReader(oneLine)); err != nil {
+		t.Fatal(err)
+	}
+	if actual := buf.String(); expected != actual {
+		t.Fatalf("expected=%q actual=%q", expected, actual)
+	}
+
+	var back bytes.Buffer
+	if err := ConvertToOneLine(&back, &buf); err != nil {
+		t.Fatal(err)
+	}
+	expected = "deb [arch+=i386 check-valid-until=no] http://ftp.debian.org/debian jessie main contrib\n" +
+		"deb-src http://ftp.debian.org/debian jessie main\n"
+	if actual := back.String(); expected != actual {
+		t.Fatalf("expected=%q actual=%q", expected, actual)
+	}
+}
+
+func TestConvertToOneLine_KeyBlock(t *testing.T) {
+	f, err := os.Open("testdata/sources/debian.sources")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var buf bytes.Buffer
+	if err := ConvertToOneLine(&buf, f); err == nil {
+		t.Fatal("expected error for embedded key block")
+	}
+}
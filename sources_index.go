@@ -0,0 +1,119 @@
+package debrepo
+
+import (
+	"crypto"
+	"fmt"
+	"net/url"
+	"path"
+)
+
+// URL returns the URL of the file name, relative to the directory holding the
+// Release file of the source's repository. This is "dists/$DIST", or the exact
+// path of a flat repository.
+// See https://wiki.debian.org/DebianRepository/Format
+func (s *Source) URL(name string) (string, error) {
+	u, err := url.Parse(s.baseURI)
+	if err != nil {
+		return "", err
+	}
+	if s.IsFlat() {
+		u.Path = path.Join(u.Path, s.distribution, name)
+	} else {
+		u.Path = path.Join(u.Path, "dists", s.distribution, name)
+	}
+	return u.String(), nil
+}
+
+// InReleaseURL returns the URL of the inline signed Release file.
+func (s *Source) InReleaseURL() (string, error) { return s.URL("InRelease") }
+
+// ReleaseURL returns the URL of the Release file.
+func (s *Source) ReleaseURL() (string, error) { return s.URL("Release") }
+
+// ReleaseGPGURL returns the URL of the detached signature of the Release file.
+func (s *Source) ReleaseGPGURL() (string, error) { return s.URL("Release.gpg") }
+
+// PackagesPath returns the path of the Packages index of component and arch,
+// relative to the directory holding the Release file. A flat repository has a
+// single Packages index and component and arch are ignored.
+func (s *Source) PackagesPath(component, arch string) string {
+	if s.IsFlat() {
+		return "Packages"
+	}
+	return path.Join(component, "binary-"+arch, "Packages")
+}
+
+// SourcesPath returns the path of the Sources index of component, relative
+// to the directory holding the Release file. A flat repository has a single
+// Sources index and component is ignored.
+func (s *Source) SourcesPath(component string) string {
+	if s.IsFlat() {
+		return "Sources"
+	}
+	return path.Join(component, "source", "Sources")
+}
+
+// IndexPath returns the path of the index listing the packages of component:
+// the Packages index of arch for a "deb" source, or the Sources index for a
+// "deb-src" source.
+func (s *Source) IndexPath(component, arch string) string {
+	if s.repoType == "deb-src" {
+		return s.SourcesPath(component)
+	}
+	return s.PackagesPath(component, arch)
+}
+
+// ContentsPath returns the path of the Contents index of component and arch,
+// relative to the directory holding the Release file. The Contents index of a
+// "deb-src" source is "Contents-source" and arch is ignored.
+func (s *Source) ContentsPath(component, arch string) string {
+	if s.repoType == "deb-src" {
+		arch = "source"
+	}
+	if s.IsFlat() {
+		return "Contents-" + arch
+	}
+	return path.Join(component, "Contents-"+arch)
+}
+
+// TranslationPath returns the path of the Translation index of component for
+// the language lang, such as "en" or "pt_BR", relative to the directory
+// holding the Release file.
+func (s *Source) TranslationPath(component, lang string) string {
+	if s.IsFlat() {
+		return "Translation-" + lang
+	}
+	return path.Join(component, "i18n", "Translation-"+lang)
+}
+
+// PackagesURL returns the URL of the Packages index of component and arch.
+func (s *Source) PackagesURL(component, arch string) (string, error) {
+	return s.URL(s.PackagesPath(component, arch))
+}
+
+// SourcesURL returns the URL of the Sources index of component.
+func (s *Source) SourcesURL(component string) (string, error) {
+	return s.URL(s.SourcesPath(component))
+}
+
+// ContentsURL returns the URL of the Contents index of component and arch.
+func (s *Source) ContentsURL(component, arch string) (string, error) {
+	return s.URL(s.ContentsPath(component, arch))
+}
+
+// TranslationURL returns the URL of the Translation index of component for
+// the language lang.
+func (s *Source) TranslationURL(component, lang string) (string, error) {
+	return s.URL(s.TranslationPath(component, lang))
+}
+
+// ByHashURL returns the URL at which the file name, relative to the directory
+// holding the Release file, is retrieved by its checksum sum computed with h.
+// Only the hashes listed in a Release file are supported.
+// See https://wiki.debian.org/DebianRepository/Format#indices_acquisition_via_hashsums_.28by-hash.29
+func (s *Source) ByHashURL(name string, h crypto.Hash, sum []byte) (string, error) {
+	if _, ok := byHashDirs[h]; !ok {
+		return "", fmt.Errorf("unsupported by-hash checksum: %v", h)
+	}
+	return s.URL(byHashPath(name, fileChecksum{Hash: h, Sum: sum}))
+}
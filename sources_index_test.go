@@ -0,0 +1,67 @@
+package debrepo
+
+import (
+	"crypto"
+	"testing"
+)
+
+func TestSource_IndexURLs(t *testing.T) {
+	deb, err := ParseSource("deb http://ftp.debian.org/debian jessie main")
+	if err != nil {
+		t.Fatal(err)
+	}
+	debSrc, err := ParseSource("deb-src http://ftp.debian.org/debian jessie main")
+	if err != nil {
+		t.Fatal(err)
+	}
+	flat, err := ParseSource("deb http://example.org/local/ ./")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sum := []byte{0xde, 0xad, 0xbe, 0xef}
+	tests := []struct {
+		url func() (string, error)
+		str string
+	}{
+		{deb.InReleaseURL, "http://ftp.debian.org/debian/dists/jessie/InRelease"},
+		{deb.ReleaseURL, "http://ftp.debian.org/debian/dists/jessie/Release"},
+		{deb.ReleaseGPGURL, "http://ftp.debian.org/debian/dists/jessie/Release.gpg"},
+		{flat.InReleaseURL, "http://example.org/local/InRelease"},
+		{flat.ReleaseGPGURL, "http://example.org/local/Release.gpg"},
+		{func() (string, error) { return deb.PackagesURL("main", "amd64") },
+			"http://ftp.debian.org/debian/dists/jessie/main/binary-amd64/Packages"},
+		{func() (string, error) { return flat.PackagesURL("main", "amd64") },
+			"http://example.org/local/Packages"},
+		{func() (string, error) { return deb.SourcesURL("main") },
+			"http://ftp.debian.org/debian/dists/jessie/main/source/Sources"},
+		{func() (string, error) { return flat.SourcesURL("main") },
+			"http://example.org/local/Sources"},
+		{func() (string, error) { return deb.ContentsURL("main", "amd64") },
+			"http://ftp.debian.org/debian/dists/jessie/main/Contents-amd64"},
+		{func() (string, error) { return debSrc.ContentsURL("main", "amd64") },
+			"http://ftp.debian.org/debian/dists/jessie/main/Contents-source"},
+		{func() (string, error) { return deb.TranslationURL("main", "pt_BR") },
+			"http://ftp.debian.org/debian/dists/jessie/main/i18n/Translation-pt_BR"},
+		{func() (string, error) { return deb.URL(deb.IndexPath("main", "amd64")) },
+			"http://ftp.debian.org/debian/dists/jessie/main/binary-amd64/Packages"},
+		{func() (string, error) { return debSrc.URL(debSrc.IndexPath("main", "amd64")) },
+			"http://ftp.debian.org/debian/dists/jessie/main/source/Sources"},
+		{func() (string, error) { return deb.ByHashURL("main/binary-amd64/Packages.xz", crypto.SHA256, sum) },
+			"http://ftp.debian.org/debian/dists/jessie/main/binary-amd64/by-hash/SHA256/deadbeef"},
+		{func() (string, error) { return flat.ByHashURL("Packages.gz", crypto.MD5, sum) },
+			"http://example.org/local/by-hash/MD5Sum/deadbeef"},
+	}
+	for i, tt := range tests {
+		str, err := tt.url()
+		if err != nil {
+			t.Fatalf("test(%v): %v", i, err)
+		}
+		if expected, actual := tt.str, str; expected != actual {
+			t.Fatalf("test(%v): expected=%v actual=%v", i, expected, actual)
+		}
+	}
+
+	if _, err := deb.ByHashURL("main/binary-amd64/Packages", crypto.SHA224, sum); err == nil {
+		t.Fatal("expected error for unsupported hash")
+	}
+}
@@ -0,0 +1,68 @@
+package debrepo
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// LoadSourceList reads the APT source configuration of the filesystem at
+// root. It is equivalent to LoadSourceListDir(root + "/etc/apt").
+func LoadSourceList(root string) (SourceList, error) {
+	return LoadSourceListDir(filepath.Join(root, "etc", "apt"))
+}
+
+// LoadSourceListDir reads the source lists of the APT configuration directory
+// dir, usually "/etc/apt". The one-line format file "sources.list" is read
+// first, followed by the files in "sources.list.d" in lexical order. Files
+// ending in ".list" are read in the one-line format and files ending in
+// ".sources" in the deb822 format. Other files, such as backups, are ignored
+// as they are by APT. Missing files and directories are not an error.
+//
+// Invalid entries are reported as a *SourceListError identifying the file and
+// line.
+func LoadSourceListDir(dir string) (SourceList, error) {
+	sl, err := loadSourceListFile(filepath.Join(dir, "sources.list"), ReadOneLineSourceList)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	partsDir := filepath.Join(dir, "sources.list.d")
+	parts, err := ioutil.ReadDir(partsDir)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	for _, fi := range parts {
+		if fi.IsDir() {
+			continue
+		}
+		var read func(io.Reader) (SourceList, error)
+		switch filepath.Ext(fi.Name()) {
+		case ".list":
+			read = ReadOneLineSourceList
+		case ".sources":
+			read = ReadSourceList
+		default:
+			continue
+		}
+		part, err := loadSourceListFile(filepath.Join(partsDir, fi.Name()), read)
+		if err != nil {
+			return nil, err
+		}
+		sl = append(sl, part...)
+	}
+	return sl, nil
+}
+
+func loadSourceListFile(path string, read func(io.Reader) (SourceList, error)) (SourceList, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	sl, err := read(f)
+	if serr, ok := err.(*SourceListError); ok {
+		serr.File = path
+	}
+	return sl, err
+}
@@ -0,0 +1,73 @@
+package debrepo
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestLoadSourceList(t *testing.T) {
+	sl, err := LoadSourceList("testdata/root")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{
+		"deb http://ftp.debian.org/debian jessie main contrib",
+		"deb-src http://ftp.debian.org/debian jessie main",
+		"deb http://security.debian.org/ jessie/updates main",
+		"deb [arch=amd64 signed-by=/usr/share/keyrings/vendor.gpg] https://packages.example.com/apt stable main",
+	}
+	if actual := sourceListStrings(sl); !reflect.DeepEqual(expected, actual) {
+		t.Fatalf("expected=%q actual=%q", expected, actual)
+	}
+}
+
+func TestLoadSourceList_Missing(t *testing.T) {
+	sl, err := LoadSourceList("testdata/nonexistent")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected, actual := 0, len(sl); expected != actual {
+		t.Fatalf("expected=%v actual=%v", expected, actual)
+	}
+}
+
+func TestLoadSourceList_Errors(t *testing.T) {
+	tests := []struct {
+		file     string
+		contents string
+		line     int
+	}{
+		{"sources.list", "# comment\ndeb http://ftp.debian.org/debian jessie main\ndeb http://ftp.debian.org/debian\n", 3},
+		{"sources.list.d/a.list", "\n\ndeb [arch=amd64 http://ftp.debian.org/debian jessie main\n", 3},
+		{"sources.list.d/b.sources", "Types: deb\nURIs: http://ftp.debian.org/debian\nSuites: jessie\nComponents: main\n\nTypes: deb\nSuites: jessie\n", 6},
+		{"sources.list.d/c.sources", "Types: deb\n continuation\n bad\nURIs http://ftp.debian.org/debian\n", 4},
+	}
+	for i, tt := range tests {
+		dir, err := ioutil.TempDir("", "debrepo")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dir)
+		path := filepath.Join(dir, "etc", "apt", tt.file)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(tt.contents), 0644); err != nil {
+			t.Fatal(err)
+		}
+		_, err = LoadSourceList(dir)
+		serr, ok := err.(*SourceListError)
+		if !ok {
+			t.Fatalf("test(%v): expected *SourceListError, got %v", i, err)
+		}
+		if expected, actual := path, serr.File; expected != actual {
+			t.Fatalf("test(%v): file: expected=%v actual=%v", i, expected, actual)
+		}
+		if expected, actual := tt.line, serr.Line; expected != actual {
+			t.Fatalf("test(%v): line: expected=%v actual=%v", i, expected, actual)
+		}
+	}
+}
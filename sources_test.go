@@ -1,6 +1,7 @@
 package debrepo
 
 import (
+	"fmt"
 	"reflect"
 	"testing"
 )
@@ -51,6 +52,115 @@ var sourceTests = []struct {
 		str:    "",
 		err:    InvalidSourceEntry,
 	},
+	{
+		entry: "deb [arch=amd64,arm64 signed-by=/usr/share/keyrings/x.gpg] https://example.com/debian bookworm main",
+		source: &Source{
+			repoType: "deb",
+			options: []SourceOption{
+				{Name: "arch", Operator: "=", Values: []string{"amd64", "arm64"}},
+				{Name: "signed-by", Operator: "=", Values: []string{"/usr/share/keyrings/x.gpg"}},
+			},
+			baseURI:      "https://example.com/debian",
+			distribution: "bookworm",
+			components:   []string{"main"},
+		},
+		str: "deb [arch=amd64,arm64 signed-by=/usr/share/keyrings/x.gpg] https://example.com/debian bookworm main",
+		err: nil,
+	},
+	{
+		entry: "deb [ lang+=de trusted=yes ]  http://ftp.debian.org/debian\tjessie main",
+		source: &Source{
+			repoType: "deb",
+			options: []SourceOption{
+				{Name: "lang", Operator: "+=", Values: []string{"de"}},
+				{Name: "trusted", Operator: "=", Values: []string{"yes"}},
+			},
+			baseURI:      "http://ftp.debian.org/debian",
+			distribution: "jessie",
+			components:   []string{"main"},
+		},
+		str: "deb [lang+=de trusted=yes] http://ftp.debian.org/debian jessie main",
+		err: nil,
+	},
+	{
+		entry:  "deb [arch=amd64 http://ftp.debian.org/debian jessie main",
+		source: nil,
+		str:    "",
+		err:    InvalidSourceEntry,
+	},
+	{
+		entry:  "deb [] http://ftp.debian.org/debian jessie main",
+		source: nil,
+		str:    "",
+		err:    InvalidSourceEntry,
+	},
+	{
+		entry:  "deb [arch] http://ftp.debian.org/debian jessie main",
+		source: nil,
+		str:    "",
+		err:    InvalidSourceEntry,
+	},
+	{
+		entry:  "deb [arch=amd64,] http://ftp.debian.org/debian jessie main",
+		source: nil,
+		str:    "",
+		err:    InvalidSourceEntry,
+	},
+	{
+		entry:  "deb [+=amd64] http://ftp.debian.org/debian jessie main",
+		source: nil,
+		str:    "",
+		err:    InvalidSourceEntry,
+	},
+	{
+		entry: "deb http://example.org/debian ./",
+		source: &Source{
+			repoType:     "deb",
+			baseURI:      "http://example.org/debian",
+			distribution: "./",
+		},
+		str: "deb http://example.org/debian ./",
+		err: nil,
+	},
+	{
+		entry: "deb-src http://example.org/debian stable/source/",
+		source: &Source{
+			repoType:     "deb-src",
+			baseURI:      "http://example.org/debian",
+			distribution: "stable/source/",
+		},
+		str: "deb-src http://example.org/debian stable/source/",
+		err: nil,
+	},
+	{
+		entry: "deb file:///srv/mirror/debian jessie main",
+		source: &Source{
+			repoType:     "deb",
+			baseURI:      "file:///srv/mirror/debian",
+			distribution: "jessie",
+			components:   []string{"main"},
+		},
+		str: "deb file:///srv/mirror/debian jessie main",
+		err: nil,
+	},
+	{
+		entry:  "deb file:srv/mirror/debian jessie main", // relative path
+		source: nil,
+		str:    "",
+		err:    InvalidSourceEntry,
+	},
+	{
+		entry:  "deb ftp.debian.org/debian jessie main", // no scheme
+		source: nil,
+		str:    "",
+		err:    InvalidSourceEntry,
+	},
+	{
+		entry:  "deb http://example.org/debian ./ main", // exact path with components
+		source: nil,
+		str:    "",
+		err:    InvalidSourceEntry,
+	},
 }
 
 func TestSource_ParseSource(t *testing.T) {
@@ -84,3 +194,127 @@ func TestSource_EmptySource_StringReturnsEmptyString(t *testing.T) {
 		t.Fatalf("expected=\"%s\" actual=\"%s\"", expected, actual)
 	}
 }
+
+func TestSource_Options(t *testing.T) {
+	fingerprint := "126C0D24BD8A2942CC7DF8AC7638D0442B90D010"
+	source, err := ParseSource("deb [arch=amd64,i386 lang=en target=Contents-deb trusted=yes check-valid-until=no " +
+		"signed-by=/usr/share/keyrings/debian.gpg," + fingerprint + "!] http://ftp.debian.org/debian jessie main")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected, actual := []string{"amd64", "i386"}, source.Architectures(); !reflect.DeepEqual(expected, actual) {
+		t.Fatalf("Architectures: expected=%v actual=%v", expected, actual)
+	}
+	if expected, actual := []string{"en"}, source.Languages(); !reflect.DeepEqual(expected, actual) {
+		t.Fatalf("Languages: expected=%v actual=%v", expected, actual)
+	}
+	if expected, actual := []string{"Contents-deb"}, source.Targets(); !reflect.DeepEqual(expected, actual) {
+		t.Fatalf("Targets: expected=%v actual=%v", expected, actual)
+	}
+	if expected, actual := []string{"/usr/share/keyrings/debian.gpg"}, source.SignedByKeyrings(); !reflect.DeepEqual(expected, actual) {
+		t.Fatalf("SignedByKeyrings: expected=%v actual=%v", expected, actual)
+	}
+	fingerprints := source.SignedByFingerprints()
+	if len(fingerprints) != 1 || fmt.Sprintf("%X", fingerprints[0]) != fingerprint {
+		t.Fatalf("SignedByFingerprints: expected=%v actual=%X", fingerprint, fingerprints)
+	}
+	if !source.Trusted() {
+		t.Fatal("expected source to be trusted")
+	}
+	if source.CheckValidUntil() {
+		t.Fatal("expected check-valid-until to be disabled")
+	}
+	if _, ok := source.Option("pdiffs"); ok {
+		t.Fatal("expected pdiffs option to be unset")
+	}
+
+	source, err = ParseSource("deb http://ftp.debian.org/debian jessie main")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if source.Architectures() != nil || source.Trusted() || !source.CheckValidUntil() {
+		t.Fatal("expected option defaults")
+	}
+}
+
+func TestNewSource(t *testing.T) {
+	components := []string{"main", "contrib"}
+	option := SourceOption{Name: "arch", Operator: "=", Values: []string{"amd64"}}
+	source, err := NewSource("deb", "http://ftp.debian.org/debian", "jessie", components, option)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected, actual := "deb [arch=amd64] http://ftp.debian.org/debian jessie main contrib", source.String(); expected != actual {
+		t.Fatalf("expected=%v actual=%v", expected, actual)
+	}
+	components[0] = "non-free"
+	if expected, actual := []string{"main", "contrib"}, source.Components(); !reflect.DeepEqual(expected, actual) {
+		t.Fatalf("expected=%v actual=%v", expected, actual)
+	}
+	if expected, actual := "deb", source.Type(); expected != actual {
+		t.Fatalf("expected=%v actual=%v", expected, actual)
+	}
+	if expected, actual := "ftp.debian.org", source.URI().Host; expected != actual {
+		t.Fatalf("expected=%v actual=%v", expected, actual)
+	}
+	if expected, actual := "jessie", source.Suite(); expected != actual {
+		t.Fatalf("expected=%v actual=%v", expected, actual)
+	}
+	if expected, actual := []SourceOption{option}, source.Options(); !reflect.DeepEqual(expected, actual) {
+		t.Fatalf("expected=%v actual=%v", expected, actual)
+	}
+
+	parsed, err := ParseSource(source.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !source.Equal(parsed) {
+		t.Fatalf("expected %v to equal %v", source, parsed)
+	}
+
+	invalid := []struct {
+		repoType, uri, suite string
+		components           []string
+		options              []SourceOption
+	}{
+		{"rpm", "http://ftp.debian.org/debian", "jessie", []string{"main"}, nil},
+		{"deb", "#notURL", "jessie", []string{"main"}, nil},
+		{"deb", "http://ftp.debian.org/debian", "", []string{"main"}, nil},
+		{"deb", "http://ftp.debian.org/debian", "jessie", nil, nil},
+		{"deb", "http://ftp.debian.org/debian", "./", []string{"main"}, nil},
+		{"deb", "http://ftp.debian.org/debian", "jessie", []string{"main"},
+			[]SourceOption{{Name: "arch", Operator: "*=", Values: []string{"amd64"}}}},
+		{"deb", "http://ftp.debian.org/debian", "jessie", []string{"main"},
+			[]SourceOption{{Name: "arch", Operator: "=", Values: []string{""}}}},
+		{"deb", "http://ftp.debian.org/debian", "jessie", []string{"main"},
+			[]SourceOption{{Name: "", Operator: "=", Values: []string{"amd64"}}}},
+	}
+	for i, tt := range invalid {
+		_, err := NewSource(tt.repoType, tt.uri, tt.suite, tt.components, tt.options...)
+		if expected, actual := InvalidSourceEntry, err; expected != actual {
+			t.Fatalf("test(%v): expected=%v actual=%v", i, expected, actual)
+		}
+	}
+}
+
+func TestSource_Clone(t *testing.T) {
+	source, err := ParseSource("deb [arch=amd64,i386] http://ftp.debian.org/debian jessie main contrib")
+	if err != nil {
+		t.Fatal(err)
+	}
+	clone := source.Clone()
+	if !source.Equal(clone) {
+		t.Fatalf("expected %v to equal %v", source, clone)
+	}
+	clone.components[0] = "non-free"
+	clone.options[0].Values[0] = "arm64"
+	if expected, actual := "deb [arch=amd64,i386] http://ftp.debian.org/debian jessie main contrib", source.String(); expected != actual {
+		t.Fatalf("expected=%v actual=%v", expected, actual)
+	}
+	if source.Equal(clone) {
+		t.Fatal("expected modified clone to differ")
+	}
+	if source.Equal(nil) {
+		t.Fatal("expected source to differ from nil")
+	}
+}
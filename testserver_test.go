@@ -3,8 +3,6 @@ package debrepo
 import (
 	"net/http"
 	"net/http/httptest"
-	"net/url"
-	"path"
 	"strings"
 	"testing"
 	"time"
@@ -66,9 +64,15 @@ func Test_TestServer_KeyRing(t *testing.T) {
 func Test_TestServer_FileServer(t *testing.T) {
 	ts := newTestServer()
 	defer ts.Close()
-	u, _ := url.Parse(ts.URL)
-	u.Path = path.Join(ts.URIRoot(), "dists", ts.Distribution(), "Release")
-	resp, err := http.Get(u.String())
+	source, err := ParseSource("deb " + ts.URL + ts.URIRoot() + " " + ts.Distribution() + " main")
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, err := source.ReleaseURL()
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := http.Get(u)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -0,0 +1,132 @@
+package debrepo
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+)
+
+const (
+	// UnsupportedScheme is returned when no Transport is registered for the
+	// scheme of a repository URI.
+	UnsupportedScheme = Error("unsupported URI scheme")
+
+	// NotModified is returned by a ConditionalTransport when a file has not
+	// changed since it was cached.
+	NotModified = Error("file not modified")
+)
+
+// A Transport retrieves files from repositories whose URIs use a particular
+// scheme. Transports are registered with a Client using RegisterTransport.
+type Transport interface {
+	// Open returns the contents of the file at u. The caller must close it.
+	// FileNotFound must be returned if the file does not exist.
+	Open(u *url.URL) (io.ReadCloser, error)
+}
+
+// CacheValidators identify the version of a cached file to the server it was
+// retrieved from.
+type CacheValidators struct {
+	ETag         string
+	LastModified string
+}
+
+// A ConditionalTransport is a Transport which can avoid retrieving a file
+// again if it has not changed since it was cached.
+type ConditionalTransport interface {
+	Transport
+	// OpenIfModified is like Open, but returns NotModified if the file
+	// identified by cached has not changed. The validators of the retrieved
+	// file are returned along with its contents.
+	OpenIfModified(u *url.URL, cached CacheValidators) (io.ReadCloser, CacheValidators, error)
+}
+
+// HTTPTransport retrieves files over HTTP and HTTPS. If Client is nil,
+// http.DefaultClient is used.
+type HTTPTransport struct {
+	Client *http.Client
+}
+
+// Open returns the body of the response to a GET request for u.
+func (t *HTTPTransport) Open(u *url.URL) (io.ReadCloser, error) {
+	body, _, err := t.OpenIfModified(u, CacheValidators{})
+	return body, err
+}
+
+// OpenIfModified sends a conditional GET request for u using the
+// If-None-Match and If-Modified-Since headers.
+func (t *HTTPTransport) OpenIfModified(u *url.URL, cached CacheValidators) (io.ReadCloser, CacheValidators, error) {
+	client := t.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	req, err := http.NewRequest("GET", u.String(), nil)
+	if err != nil {
+		return nil, CacheValidators{}, err
+	}
+	if len(cached.ETag) > 0 {
+		req.Header.Set("If-None-Match", cached.ETag)
+	}
+	if len(cached.LastModified) > 0 {
+		req.Header.Set("If-Modified-Since", cached.LastModified)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, CacheValidators{}, err
+	}
+	if resp.StatusCode == http.StatusNotModified {
+		resp.Body.Close()
+		return nil, cached, NotModified
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		resp.Body.Close()
+		return nil, CacheValidators{}, FileNotFound
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		resp.Body.Close()
+		return nil, CacheValidators{}, fmt.Errorf("error retrieving %s: %s", u, resp.Status)
+	}
+	validators := CacheValidators{
+		ETag:         resp.Header.Get("ETag"),
+		LastModified: resp.Header.Get("Last-Modified"),
+	}
+	return resp.Body, validators, nil
+}
+
+// FileTransport retrieves files from the local file system for "file" URIs,
+// such as "file:///srv/mirror/debian". Files are read in place.
+type FileTransport struct{}
+
+// Open opens the local file at the path of u.
+func (FileTransport) Open(u *url.URL) (io.ReadCloser, error) {
+	f, err := os.Open(u.Path)
+	if os.IsNotExist(err) {
+		return nil, FileNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// CopyTransport retrieves files from the local file system for "copy" URIs.
+// Unlike FileTransport, the file is copied into memory and closed before
+// Open returns, so the repository may be on removable or otherwise transient
+// media.
+type CopyTransport struct{}
+
+// Open reads the local file at the path of u.
+func (CopyTransport) Open(u *url.URL) (io.ReadCloser, error) {
+	b, err := ioutil.ReadFile(u.Path)
+	if os.IsNotExist(err) {
+		return nil, FileNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return ioutil.NopCloser(bytes.NewReader(b)), nil
+}
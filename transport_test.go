@@ -0,0 +1,83 @@
+package debrepo
+
+import (
+	"io"
+	"io/ioutil"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func newLocalTestSource(t *testing.T, scheme string) *Source {
+	root, err := filepath.Abs("testdata/repo/root/debian")
+	if err != nil {
+		t.Fatal(err)
+	}
+	source, err := ParseSource("deb " + scheme + "://" + filepath.ToSlash(root) + " jessie main")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return source
+}
+
+func TestClient_FetchRelease_LocalTransports(t *testing.T) {
+	ts := &testserver{}
+	for _, scheme := range []string{"file", "copy"} {
+		source := newLocalTestSource(t, scheme)
+		c := NewClient(SourceList{source}, ts.KeyRing(), nil)
+		c.SetValidityPolicy(testValidity(ts.Time()))
+		r, err := c.FetchRelease(source)
+		if err != nil {
+			t.Fatalf("%s: %v", scheme, err)
+		}
+		if expected, actual := ts.Distribution(), r.Codename; expected != actual {
+			t.Fatalf("%s: expected=%v actual=%v", scheme, expected, actual)
+		}
+	}
+}
+
+type testTransport struct {
+	files map[string]string
+}
+
+func (tt *testTransport) Open(u *url.URL) (io.ReadCloser, error) {
+	s, ok := tt.files[u.Host+u.Path]
+	if !ok {
+		return nil, FileNotFound
+	}
+	return ioutil.NopCloser(strings.NewReader(s)), nil
+}
+
+func TestClient_RegisterTransport(t *testing.T) {
+	source, err := ParseSource("deb s3://bucket/debian jessie main")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := NewClient(SourceList{source}, nil, nil)
+	u, err := source.URL("main/i18n/Translation-en")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.get(u); err != UnsupportedScheme {
+		t.Fatalf("expected=%v actual=%v", UnsupportedScheme, err)
+	}
+
+	c.RegisterTransport("S3", &testTransport{files: map[string]string{
+		"bucket/debian/dists/jessie/main/i18n/Translation-en": "Package: bash\n",
+	}})
+	b, err := c.get(u)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected, actual := "Package: bash\n", string(b); expected != actual {
+		t.Fatalf("expected=%v actual=%v", expected, actual)
+	}
+	u, err = source.ReleaseURL()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.get(u); err != FileNotFound {
+		t.Fatalf("expected=%v actual=%v", FileNotFound, err)
+	}
+}
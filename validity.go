@@ -0,0 +1,87 @@
+package debrepo
+
+import "time"
+
+// FutureRelease is returned when the Date of a Release file is further in the
+// future than the clock skew tolerated by the ValidityPolicy.
+const FutureRelease = Error("release file is not valid yet")
+
+// A ValidityPolicy determines the time a Release file is checked against and
+// how long it remains valid.
+type ValidityPolicy struct {
+	// Now returns the current time. If it is nil, time.Now is used.
+	// Setting it to a fixed time allows the analysis of historical snapshots
+	// of a repository.
+	Now func() time.Time
+	// MaxValidity limits the time a Release file is valid after its Date. A
+	// Release file whose Valid-Until field is later, or which has no
+	// Valid-Until field, expires MaxValidity after its Date. Zero means no
+	// limit.
+	MaxValidity time.Duration
+	// ClockSkew is the time the Date of a Release file may be ahead of the
+	// current time, to tolerate differences between the clocks of the client
+	// and the repository.
+	ClockSkew time.Duration
+}
+
+// DefaultValidityPolicy uses the system clock and tolerates a Date up to ten
+// minutes in the future.
+var DefaultValidityPolicy = ValidityPolicy{ClockSkew: 10 * time.Minute}
+
+func (p ValidityPolicy) now() time.Time {
+	if p.Now == nil {
+		return time.Now()
+	}
+	return p.Now()
+}
+
+// expires returns the time release expires at, or the zero time if it does
+// not expire.
+func (p ValidityPolicy) expires(release *Release) time.Time {
+	expires := release.ValidUntil
+	if p.MaxValidity > 0 {
+		if max := release.Date.Add(p.MaxValidity); expires.IsZero() || max.Before(expires) {
+			expires = max
+		}
+	}
+	return expires
+}
+
+// Check returns FutureRelease if the Date of release is in the future and a
+// *StaleReleaseError if release has expired.
+func (p ValidityPolicy) Check(release *Release) error {
+	if err := p.checkDate(release); err != nil {
+		return err
+	}
+	return p.checkValidUntil(release)
+}
+
+func (p ValidityPolicy) checkDate(release *Release) error {
+	if release.Date.After(p.now().Add(p.ClockSkew)) {
+		return FutureRelease
+	}
+	return nil
+}
+
+func (p ValidityPolicy) checkValidUntil(release *Release) error {
+	expires := p.expires(release)
+	if !expires.IsZero() && p.now().After(expires) {
+		return &StaleReleaseError{Date: release.Date, ValidUntil: expires}
+	}
+	return nil
+}
+
+// SetValidityPolicy sets the ValidityPolicy Release files are checked
+// against. Its clock is also used to check the expiration of signing keys.
+// The default is DefaultValidityPolicy.
+func (c *Client) SetValidityPolicy(p ValidityPolicy) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.validity = p
+}
+
+func (c *Client) validityPolicy() ValidityPolicy {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.validity
+}
@@ -0,0 +1,116 @@
+package debrepo
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/openpgp"
+)
+
+func TestValidityPolicy_Check(t *testing.T) {
+	now := time.Date(2016, 4, 2, 12, 0, 0, 0, time.UTC)
+	clock := func() time.Time { return now }
+	tests := []struct {
+		policy     ValidityPolicy
+		date       time.Time
+		validUntil time.Time
+		err        error
+		expires    time.Time
+	}{
+		{ValidityPolicy{Now: clock}, now.Add(-time.Hour), time.Time{}, nil, time.Time{}},
+		{ValidityPolicy{Now: clock}, now.Add(-time.Hour), now.Add(time.Hour), nil, now.Add(time.Hour)},
+		{ValidityPolicy{Now: clock}, now.Add(-2 * time.Hour), now.Add(-time.Hour), &StaleReleaseError{}, now.Add(-time.Hour)},
+		{ValidityPolicy{Now: clock, MaxValidity: 30 * time.Minute}, now.Add(-time.Hour), time.Time{}, &StaleReleaseError{}, now.Add(-30 * time.Minute)},
+		{ValidityPolicy{Now: clock, MaxValidity: 30 * time.Minute}, now.Add(-time.Hour), now.Add(time.Hour), &StaleReleaseError{}, now.Add(-30 * time.Minute)},
+		{ValidityPolicy{Now: clock, MaxValidity: 2 * time.Hour}, now.Add(-time.Hour), now.Add(time.Minute), nil, now.Add(time.Minute)},
+		{ValidityPolicy{Now: clock}, now.Add(time.Minute), time.Time{}, FutureRelease, time.Time{}},
+		{ValidityPolicy{Now: clock, ClockSkew: 5 * time.Minute}, now.Add(time.Minute), time.Time{}, nil, time.Time{}},
+	}
+	for i, tt := range tests {
+		release := &Release{Date: tt.date, ValidUntil: tt.validUntil}
+		err := tt.policy.Check(release)
+		switch expected := tt.err.(type) {
+		case *StaleReleaseError:
+			actual, ok := err.(*StaleReleaseError)
+			if !ok {
+				t.Fatalf("test(%v): expected=%T actual=%v", i, expected, err)
+			}
+			if !tt.expires.Equal(actual.ValidUntil) {
+				t.Fatalf("test(%v): expected=%v actual=%v", i, tt.expires, actual.ValidUntil)
+			}
+		default:
+			if expected != err {
+				t.Fatalf("test(%v): expected=%v actual=%v", i, expected, err)
+			}
+		}
+		if expected, actual := tt.expires, tt.policy.expires(release); !expected.Equal(actual) {
+			t.Fatalf("test(%v): expected=%v actual=%v", i, expected, actual)
+		}
+	}
+}
+
+func TestClient_SetValidityPolicy(t *testing.T) {
+	ts := newReleaseStateTestServer(t)
+	defer ts.Close()
+	ts.SetDate(t, "Sat, 02 Apr 2016 09:54:11 UTC\nValid-Until: Sat, 09 Apr 2016 09:54:11 UTC")
+	source := newTestSource(t, ts.URL+"/debian")
+
+	snapshot := func() time.Time { return time.Date(2016, 4, 5, 0, 0, 0, 0, time.UTC) }
+	tests := []struct {
+		policy ValidityPolicy
+		valid  bool
+	}{
+		{DefaultValidityPolicy, false},
+		{ValidityPolicy{Now: snapshot}, true},
+		{ValidityPolicy{Now: snapshot, MaxValidity: 24 * time.Hour}, false},
+		{ValidityPolicy{Now: func() time.Time { return time.Date(2016, 4, 1, 0, 0, 0, 0, time.UTC) }}, false},
+	}
+	for i, tt := range tests {
+		c := NewClient(SourceList{source}, openpgp.EntityList{ts.entity}, nil)
+		c.SetValidityPolicy(tt.policy)
+		_, err := c.FetchRelease(source)
+		if expected, actual := tt.valid, err == nil; expected != actual {
+			t.Fatalf("test(%v): expected=%v actual=%v (%v)", i, expected, actual, err)
+		}
+	}
+}
+
+func TestClient_FetchRelease_CheckValidUntil(t *testing.T) {
+	ts := newReleaseStateTestServer(t)
+	defer ts.Close()
+	ts.SetDate(t, "Sat, 02 Apr 2016 09:54:11 UTC\nValid-Until: Sun, 03 Apr 2016 09:54:11 UTC")
+	source, err := ParseSource("deb [check-valid-until=no] " + ts.URL + "/debian jessie main")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := NewClient(SourceList{source}, openpgp.EntityList{ts.entity}, nil)
+	c.SetValidityPolicy(ValidityPolicy{MaxValidity: time.Hour})
+	if _, err := c.FetchRelease(source); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReleaseParser_Validity(t *testing.T) {
+	ts := newReleaseStateTestServer(t)
+	defer ts.Close()
+	b := ts.SetDate(t, "Sat, 02 Apr 2016 09:54:11 UTC\nValid-Until: Sat, 09 Apr 2016 09:54:11 UTC")
+	snapshot := testValidity(time.Date(2016, 4, 5, 0, 0, 0, 0, time.UTC))
+
+	if _, err := ReadRelease(bytes.NewReader(b)); err == nil {
+		t.Fatal("expected error for expired release")
+	}
+	if _, _, err := (&ReleaseParser{Validity: &snapshot}).Parse(bytes.NewReader(b)); err != nil {
+		t.Fatal(err)
+	}
+	ts.mu.Lock()
+	signed := ts.signed
+	ts.mu.Unlock()
+	keyring := openpgp.EntityList{ts.entity}
+	if _, _, err := ReadInRelease(bytes.NewReader(signed), keyring); err == nil {
+		t.Fatal("expected error for expired release")
+	}
+	if _, _, err := (&ReleaseVerifier{KeyRing: keyring, Validity: &snapshot}).ReadInRelease(bytes.NewReader(signed)); err != nil {
+		t.Fatal(err)
+	}
+}
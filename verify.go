@@ -0,0 +1,279 @@
+package debrepo
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"time"
+
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/armor"
+	"golang.org/x/crypto/openpgp/clearsign"
+	"golang.org/x/crypto/openpgp/packet"
+)
+
+const (
+	// UnknownSigningKey is returned when a signature was not made by any key
+	// in the keyring.
+	UnknownSigningKey = Error("signature made by unknown key")
+
+	// ExpiredSigningKey is returned when a signature was made by a key which
+	// has expired.
+	ExpiredSigningKey = Error("signature made by expired key")
+
+	// InvalidSignature is returned when a signature does not match the signed
+	// data.
+	InvalidSignature = Error("invalid signature")
+
+	// UntrustedSigner is returned when a Release is signed by a key not listed
+	// in the Signed-By field of the previously trusted Release.
+	UntrustedSigner = Error("signing key not listed in Signed-By of trusted release")
+)
+
+// A Signer identifies the key which produced a valid signature.
+type Signer struct {
+	// Entity is the keyring entity owning the signing key.
+	Entity *openpgp.Entity
+	// PublicKey is the key which made the signature. It is either the primary
+	// key of Entity or one of its subkeys.
+	PublicKey *packet.PublicKey
+	// Fingerprint is the fingerprint of PublicKey.
+	Fingerprint [20]byte
+	// CreationTime is the time at which PublicKey was created.
+	CreationTime time.Time
+	// Expiry is the time at which PublicKey expires. An empty Time means the
+	// key does not expire.
+	Expiry time.Time
+}
+
+func newSigner(key openpgp.Key) *Signer {
+	signer := &Signer{
+		Entity:       key.Entity,
+		PublicKey:    key.PublicKey,
+		Fingerprint:  key.PublicKey.Fingerprint,
+		CreationTime: key.PublicKey.CreationTime,
+	}
+	if sig := key.SelfSignature; sig != nil && sig.KeyLifetimeSecs != nil && *sig.KeyLifetimeSecs != 0 {
+		lifetime := time.Duration(*sig.KeyLifetimeSecs) * time.Second
+		signer.Expiry = key.PublicKey.CreationTime.Add(lifetime)
+	}
+	return signer
+}
+
+// IsSubkey reports whether the signature was made by a subkey of Entity.
+func (s *Signer) IsSubkey() bool {
+	return s.PublicKey != s.Entity.PrimaryKey
+}
+
+// AcceptsSigner reports whether the Signed-By field of r permits the next
+// Release of the distribution to be signed by signer. If the field is empty,
+// any signer is accepted. Otherwise the fingerprint of the concrete key which
+// made the signature must be listed. A signature made by a subkey is only
+// accepted if the subkey fingerprint is listed, as required by APT 1.3.
+func (r *Release) AcceptsSigner(signer *Signer) bool {
+	if len(r.SignedBy) == 0 {
+		return true
+	}
+	for _, fingerprint := range r.SignedBy {
+		if fingerprint == signer.Fingerprint {
+			return true
+		}
+	}
+	return false
+}
+
+// acceptsAnySigner reports whether AcceptsSigner is true for any of signers.
+// A Release signed by both an old and a new key during key rotation is
+// accepted if either key is listed, as in APT.
+func (r *Release) acceptsAnySigner(signers []*Signer) bool {
+	for _, signer := range signers {
+		if r.AcceptsSigner(signer) {
+			return true
+		}
+	}
+	return false
+}
+
+// ReadInRelease returns a Release from an InRelease file. The OpenPGP
+// cleartext signature is verified against keyring before the Release is
+// parsed. The key which made the first valid signature is returned along with
+// the Release.
+// See https://wiki.debian.org/RepositoryFormat#A.22Release.22_files
+func ReadInRelease(r io.Reader, keyring openpgp.KeyRing) (*Release, *Signer, error) {
+	release, signers, err := (&ReleaseVerifier{KeyRing: keyring}).ReadInRelease(r)
+	if err != nil {
+		return nil, nil, err
+	}
+	return release, signers[0], nil
+}
+
+// VerifyRelease returns a Release from a Release file after checking it
+// against its detached signature, usually named Release.gpg. The signature may
+// be ASCII armored or binary. The key which made the first valid signature is
+// returned along with the Release.
+func VerifyRelease(release io.Reader, sig io.Reader, keyring openpgp.KeyRing) (*Release, *Signer, error) {
+	r, signers, err := (&ReleaseVerifier{KeyRing: keyring}).VerifyRelease(release, sig)
+	if err != nil {
+		return nil, nil, err
+	}
+	return r, signers[0], nil
+}
+
+// A ReleaseVerifier verifies the signatures of Release files and parses them.
+// ReadInRelease and VerifyRelease use a ReleaseVerifier with the default
+// policy.
+type ReleaseVerifier struct {
+	// KeyRing holds the keys signatures are verified against.
+	KeyRing openpgp.KeyRing
+	// Validity is the ValidityPolicy the Release and the expiration of the
+	// signing keys are checked against. If it is nil, DefaultValidityPolicy
+	// is used.
+	Validity *ValidityPolicy
+}
+
+func (v *ReleaseVerifier) validity() *ValidityPolicy {
+	if v.Validity == nil {
+		return &DefaultValidityPolicy
+	}
+	return v.Validity
+}
+
+// ReadInRelease returns a Release from an InRelease file and the keys which
+// made valid signatures of it.
+func (v *ReleaseVerifier) ReadInRelease(r io.Reader) (*Release, []*Signer, error) {
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, nil, err
+	}
+	plaintext, signers, err := verifyInRelease(b, v.KeyRing, v.validity().now())
+	if err != nil {
+		return nil, nil, err
+	}
+	release, _, err := (&ReleaseParser{Validity: v.validity()}).Parse(bytes.NewReader(plaintext))
+	if err != nil {
+		return nil, nil, err
+	}
+	return release, signers, nil
+}
+
+// VerifyRelease returns a Release from a Release file after checking it
+// against its detached signature, along with the keys which made valid
+// signatures of it.
+func (v *ReleaseVerifier) VerifyRelease(release io.Reader, sig io.Reader) (*Release, []*Signer, error) {
+	signed, err := ioutil.ReadAll(release)
+	if err != nil {
+		return nil, nil, err
+	}
+	signature, err := ioutil.ReadAll(sig)
+	if err != nil {
+		return nil, nil, err
+	}
+	signers, err := verifyDetachedRelease(signed, signature, v.KeyRing, v.validity().now())
+	if err != nil {
+		return nil, nil, err
+	}
+	r, _, err := (&ReleaseParser{Validity: v.validity()}).Parse(bytes.NewReader(signed))
+	if err != nil {
+		return nil, nil, err
+	}
+	return r, signers, nil
+}
+
+// verifyInRelease checks the cleartext signature of the InRelease file b and
+// returns the signed plaintext and the keys which made valid signatures.
+func verifyInRelease(b []byte, keyring openpgp.KeyRing, now time.Time) ([]byte, []*Signer, error) {
+	block, _ := clearsign.Decode(b)
+	if block == nil {
+		return nil, nil, InvalidInRelease
+	}
+	signature, err := ioutil.ReadAll(block.ArmoredSignature.Body)
+	if err != nil {
+		return nil, nil, err
+	}
+	signers, err := verifySignature(keyring, block.Bytes, signature, now)
+	if err != nil {
+		return nil, nil, err
+	}
+	return block.Plaintext, signers, nil
+}
+
+// verifyDetachedRelease checks the ASCII armored or binary detached signature
+// of a Release file.
+func verifyDetachedRelease(signed, signature []byte, keyring openpgp.KeyRing, now time.Time) ([]*Signer, error) {
+	if bytes.HasPrefix(bytes.TrimSpace(signature), []byte("-----BEGIN ")) {
+		block, err := armor.Decode(bytes.NewReader(signature))
+		if err != nil {
+			return nil, err
+		}
+		if block.Type != openpgp.SignatureType {
+			return nil, InvalidSignature
+		}
+		if signature, err = ioutil.ReadAll(block.Body); err != nil {
+			return nil, err
+		}
+	}
+	return verifySignature(keyring, signed, signature, now)
+}
+
+// verifySignature checks the binary OpenPGP signature packets in signature
+// against signed and returns the keys which made valid signatures, in the
+// order of the signatures. Each signature made by a key in the keyring is
+// checked, so a file signed by both an expired and a current key is accepted. The expiration of the key is
+// checked against now. If no signature passes, ExpiredSigningKey is returned
+// if a valid signature was made by an expired key, InvalidSignature if a
+// signature made by a known key does not match and UnknownSigningKey
+// otherwise.
+func verifySignature(keyring openpgp.KeyRing, signed, signature []byte, now time.Time) ([]*Signer, error) {
+	var signers []*Signer
+	failure := UnknownSigningKey
+	checked := make(map[*openpgp.Entity]bool)
+	packets := packet.NewReader(bytes.NewReader(signature))
+	for {
+		p, err := packets.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, InvalidSignature
+		}
+		var issuerKeyID uint64
+		switch sig := p.(type) {
+		case *packet.Signature:
+			if sig.IssuerKeyId == nil {
+				continue
+			}
+			issuerKeyID = *sig.IssuerKeyId
+		case *packet.SignatureV3:
+			issuerKeyID = sig.IssuerKeyId
+		default:
+			continue
+		}
+		for _, key := range keyring.KeysByIdUsage(issuerKeyID, packet.KeyFlagSign) {
+			if checked[key.Entity] {
+				continue
+			}
+			checked[key.Entity] = true
+			// CheckDetachedSignature verifies the first signature packet
+			// issued by a key in the keyring, which is this packet when the
+			// keyring only holds its entity.
+			_, err := openpgp.CheckDetachedSignature(openpgp.EntityList{key.Entity},
+				bytes.NewReader(signed), bytes.NewReader(signature))
+			if err != nil {
+				if failure == UnknownSigningKey {
+					failure = InvalidSignature
+				}
+				continue
+			}
+			signer := newSigner(key)
+			if !signer.Expiry.IsZero() && now.After(signer.Expiry) {
+				failure = ExpiredSigningKey
+				continue
+			}
+			signers = append(signers, signer)
+		}
+	}
+	if len(signers) == 0 {
+		return nil, failure
+	}
+	return signers, nil
+}
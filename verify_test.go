@@ -0,0 +1,282 @@
+package debrepo
+
+import (
+	"bytes"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/clearsign"
+	"golang.org/x/crypto/openpgp/packet"
+)
+
+// newTestEntity returns a new OpenPGP entity whose subkey is usable for
+// signing.
+func newTestEntity(t *testing.T) *openpgp.Entity {
+	entity, err := openpgp.NewEntity("Test", "", "test@example.com", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entity.Subkeys[0].Sig.FlagSign = true
+	return entity
+}
+
+// clearsignTestFile returns the contents of the file at path clearsigned
+// with key.
+func clearsignTestFile(t *testing.T, path string, key *packet.PrivateKey) []byte {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return clearsignTestData(t, b, key)
+}
+
+func clearsignTestData(t *testing.T, b []byte, key *packet.PrivateKey) []byte {
+	buf := &bytes.Buffer{}
+	w, err := clearsign.Encode(buf, key, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Write(b); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+const testReleasePath = "testdata/repo/root/debian/dists/jessie/Release"
+
+func TestReadInRelease(t *testing.T) {
+	entity := newTestEntity(t)
+	inRelease := clearsignTestFile(t, testReleasePath, entity.PrivateKey)
+	r, signer, err := ReadInRelease(bytes.NewReader(inRelease), openpgp.EntityList{entity})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected, actual := "jessie", r.Codename; expected != actual {
+		t.Fatalf("expected=%v actual=%v", expected, actual)
+	}
+	if signer.Entity != entity {
+		t.Fatal("expected signer entity to be the test entity")
+	}
+	if signer.IsSubkey() {
+		t.Fatal("expected signature by primary key")
+	}
+}
+
+func TestReadInRelease_Subkey(t *testing.T) {
+	entity := newTestEntity(t)
+	inRelease := clearsignTestFile(t, testReleasePath, entity.Subkeys[0].PrivateKey)
+	_, signer, err := ReadInRelease(bytes.NewReader(inRelease), openpgp.EntityList{entity})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !signer.IsSubkey() {
+		t.Fatal("expected signature by subkey")
+	}
+	if expected, actual := entity.Subkeys[0].PublicKey.Fingerprint, signer.PublicKey.Fingerprint; expected != actual {
+		t.Fatalf("expected=%X actual=%X", expected, actual)
+	}
+}
+
+func TestReadInRelease_UnknownKey(t *testing.T) {
+	inRelease := clearsignTestFile(t, testReleasePath, newTestEntity(t).PrivateKey)
+	_, _, err := ReadInRelease(bytes.NewReader(inRelease), openpgp.EntityList{newTestEntity(t)})
+	if err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+func TestReadInRelease_NotClearsigned(t *testing.T) {
+	f, err := ioutil.ReadFile(testReleasePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _, err = ReadInRelease(bytes.NewReader(f), openpgp.EntityList{newTestEntity(t)})
+	if expected, actual := InvalidInRelease, err; expected != actual {
+		t.Fatalf("expected=%v actual=%v", expected, actual)
+	}
+}
+
+// testValidity returns DefaultValidityPolicy with a clock fixed at t.
+func testValidity(t time.Time) ValidityPolicy {
+	p := DefaultValidityPolicy
+	p.Now = func() time.Time { return t }
+	return p
+}
+
+// testVerifier returns a ReleaseVerifier using keyring and a clock fixed at t.
+func testVerifier(keyring openpgp.KeyRing, t time.Time) *ReleaseVerifier {
+	p := testValidity(t)
+	return &ReleaseVerifier{KeyRing: keyring, Validity: &p}
+}
+
+func openTestRelease(t *testing.T) (release, signature *os.File) {
+	release, err := os.Open(testReleasePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signature, err = os.Open(testReleasePath + ".gpg")
+	if err != nil {
+		release.Close()
+		t.Fatal(err)
+	}
+	return release, signature
+}
+
+func TestVerifyRelease(t *testing.T) {
+	ts := &testserver{}
+	release, signature := openTestRelease(t)
+	defer release.Close()
+	defer signature.Close()
+	r, signers, err := testVerifier(ts.KeyRing(), ts.Time()).VerifyRelease(release, signature)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer := signers[0]
+	if expected, actual := "jessie", r.Codename; expected != actual {
+		t.Fatalf("expected=%v actual=%v", expected, actual)
+	}
+	fingerprint, _ := hex.DecodeString("126C0D24BD8A2942CC7DF8AC7638D0442B90D010")
+	if expected, actual := fingerprint, signer.Fingerprint[:]; !bytes.Equal(expected, actual) {
+		t.Fatalf("expected=%X actual=%X", expected, actual)
+	}
+	if expected, actual := "2014-11-21", signer.CreationTime.UTC().Format("2006-01-02"); expected != actual {
+		t.Fatalf("creation time: expected=%v actual=%v", expected, actual)
+	}
+	if !signer.Expiry.After(signer.CreationTime) {
+		t.Fatalf("expected expiry after creation time, got %v", signer.Expiry)
+	}
+}
+
+func TestVerifyRelease_ExpiredKey(t *testing.T) {
+	ts := &testserver{}
+	release, signature := openTestRelease(t)
+	defer release.Close()
+	defer signature.Close()
+	_, _, err := testVerifier(ts.KeyRing(), ts.Time().AddDate(20, 0, 0)).VerifyRelease(release, signature)
+	if expected, actual := ExpiredSigningKey, err; expected != actual {
+		t.Fatalf("expected=%v actual=%v", expected, actual)
+	}
+}
+
+func TestVerifyRelease_UnknownKey(t *testing.T) {
+	release, signature := openTestRelease(t)
+	defer release.Close()
+	defer signature.Close()
+	_, _, err := VerifyRelease(release, signature, openpgp.EntityList{newTestEntity(t)})
+	if expected, actual := UnknownSigningKey, err; expected != actual {
+		t.Fatalf("expected=%v actual=%v", expected, actual)
+	}
+}
+
+func TestVerifyRelease_BadSignature(t *testing.T) {
+	ts := &testserver{}
+	b, err := ioutil.ReadFile(testReleasePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b = bytes.Replace(b, []byte("Origin: Debian"), []byte("Origin: Tampered"), 1)
+	signature, err := os.Open(testReleasePath + ".gpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer signature.Close()
+	_, _, err = testVerifier(ts.KeyRing(), ts.Time()).VerifyRelease(bytes.NewReader(b), signature)
+	if expected, actual := InvalidSignature, err; expected != actual {
+		t.Fatalf("expected=%v actual=%v", expected, actual)
+	}
+}
+
+func TestVerifyRelease_BinarySignature(t *testing.T) {
+	entity := newTestEntity(t)
+	b, err := ioutil.ReadFile(testReleasePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signature := &bytes.Buffer{}
+	if err := openpgp.DetachSign(signature, entity, bytes.NewReader(b), nil); err != nil {
+		t.Fatal(err)
+	}
+	_, signer, err := VerifyRelease(bytes.NewReader(b), signature, openpgp.EntityList{entity})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected, actual := entity.PrimaryKey.Fingerprint, signer.Fingerprint; expected != actual {
+		t.Fatalf("expected=%X actual=%X", expected, actual)
+	}
+	if !signer.Expiry.IsZero() {
+		t.Fatalf("expected no expiry, got %v", signer.Expiry)
+	}
+}
+
+// detachSignTestData returns binary detached signatures of b made by each of
+// entities.
+func detachSignTestData(t *testing.T, b []byte, entities ...*openpgp.Entity) []byte {
+	signature := &bytes.Buffer{}
+	for _, entity := range entities {
+		if err := openpgp.DetachSign(signature, entity, bytes.NewReader(b), nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return signature.Bytes()
+}
+
+// expireTestEntity makes the primary key of entity expire a minute after its
+// creation.
+func expireTestEntity(entity *openpgp.Entity) {
+	lifetime := uint32(60)
+	for _, id := range entity.Identities {
+		id.SelfSignature.KeyLifetimeSecs = &lifetime
+	}
+}
+
+func TestVerifySignature_MultipleSignatures(t *testing.T) {
+	expired, current, unknown := newTestEntity(t), newTestEntity(t), newTestEntity(t)
+	b := []byte("Origin: Example\n")
+	bothSigned := detachSignTestData(t, b, expired, current)
+	expiredSigned := detachSignTestData(t, b, expired)
+	unknownSigned := detachSignTestData(t, b, unknown)
+	expireTestEntity(expired)
+	keyring := openpgp.EntityList{expired, current}
+	now := time.Now().Add(time.Hour)
+
+	signers, err := verifySignature(keyring, b, bothSigned, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected, actual := 1, len(signers); expected != actual {
+		t.Fatalf("expected=%v actual=%v", expected, actual)
+	}
+	if expected, actual := current.PrimaryKey.Fingerprint, signers[0].Fingerprint; expected != actual {
+		t.Fatalf("expected=%X actual=%X", expected, actual)
+	}
+	// Without the expiry check both signatures are valid.
+	signers, err = verifySignature(keyring, b, bothSigned, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected, actual := 2, len(signers); expected != actual {
+		t.Fatalf("expected=%v actual=%v", expected, actual)
+	}
+
+	tests := []struct {
+		signed, signature []byte
+		err               error
+	}{
+		{b, expiredSigned, ExpiredSigningKey},
+		{b, unknownSigned, UnknownSigningKey},
+		{b, nil, UnknownSigningKey},
+		{[]byte("Origin: Tampered\n"), bothSigned, InvalidSignature},
+	}
+	for i, tt := range tests {
+		if _, err := verifySignature(keyring, tt.signed, tt.signature, now); err != tt.err {
+			t.Fatalf("test(%v): expected=%v actual=%v", i, tt.err, err)
+		}
+	}
+}
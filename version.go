@@ -0,0 +1,177 @@
+package debrepo
+
+import (
+	"strconv"
+	"strings"
+)
+
+const (
+	// InvalidVersion is returned on malformed package versions.
+	InvalidVersion = Error("invalid version")
+)
+
+// A Version is a Debian package version in the format
+// "[epoch:]upstream_version[-debian_revision]".
+// See https://www.debian.org/doc/debian-policy/ch-controlfields.html#version
+type Version struct {
+	Epoch    uint32
+	Upstream string
+	Revision string
+}
+
+// ParseVersion parses s to create a Version. It applies the same validation
+// as dpkg: the epoch must be a non-negative integer, the upstream version must
+// start with a digit and only the characters allowed by Debian policy may be
+// used.
+func ParseVersion(s string) (Version, error) {
+	s = strings.TrimSpace(s)
+	if len(s) == 0 || strings.IndexAny(s, " \t\n") != -1 {
+		return Version{}, InvalidVersion
+	}
+	var v Version
+	if i := strings.Index(s, ":"); i != -1 {
+		epoch, err := strconv.ParseUint(s[:i], 10, 31)
+		if err != nil {
+			return Version{}, InvalidVersion
+		}
+		v.Epoch = uint32(epoch)
+		s = s[i+1:]
+	}
+	v.Upstream = s
+	if i := strings.LastIndex(s, "-"); i != -1 {
+		v.Upstream, v.Revision = s[:i], s[i+1:]
+		if len(v.Revision) == 0 {
+			return Version{}, InvalidVersion
+		}
+	}
+	if len(v.Upstream) == 0 || !isDigit(v.Upstream[0]) {
+		return Version{}, InvalidVersion
+	}
+	if !validVersionChars(v.Upstream, ".-+~:") || !validVersionChars(v.Revision, ".+~") {
+		return Version{}, InvalidVersion
+	}
+	return v, nil
+}
+
+func validVersionChars(s, allowed string) bool {
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if !isDigit(c) && !isAlpha(c) && strings.IndexByte(allowed, c) == -1 {
+			return false
+		}
+	}
+	return true
+}
+
+func (v Version) String() string {
+	s := v.Upstream
+	if v.Epoch > 0 {
+		s = strconv.FormatUint(uint64(v.Epoch), 10) + ":" + s
+	}
+	if len(v.Revision) > 0 {
+		s += "-" + v.Revision
+	}
+	return s
+}
+
+// Compare returns -1 if v is older than other, 0 if they are equal and 1 if v
+// is newer, using the ordering implemented by dpkg.
+func (v Version) Compare(other Version) int {
+	if v.Epoch != other.Epoch {
+		if v.Epoch < other.Epoch {
+			return -1
+		}
+		return 1
+	}
+	if c := compareVersionPart(v.Upstream, other.Upstream); c != 0 {
+		return c
+	}
+	return compareVersionPart(v.Revision, other.Revision)
+}
+
+// CompareVersions parses and compares the versions a and b. See
+// Version.Compare.
+func CompareVersions(a, b string) (int, error) {
+	va, err := ParseVersion(a)
+	if err != nil {
+		return 0, err
+	}
+	vb, err := ParseVersion(b)
+	if err != nil {
+		return 0, err
+	}
+	return va.Compare(vb), nil
+}
+
+// compareVersionPart compares upstream versions or revisions. Non-digit
+// prefixes are compared with order and digit sequences numerically, in turn.
+func compareVersionPart(a, b string) int {
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		for (i < len(a) && !isDigit(a[i])) || (j < len(b) && !isDigit(b[j])) {
+			ac, bc := order(a, i), order(b, j)
+			if ac != bc {
+				return sign(ac - bc)
+			}
+			i++
+			j++
+		}
+		for i < len(a) && a[i] == '0' {
+			i++
+		}
+		for j < len(b) && b[j] == '0' {
+			j++
+		}
+		firstDiff := 0
+		for i < len(a) && isDigit(a[i]) && j < len(b) && isDigit(b[j]) {
+			if firstDiff == 0 {
+				firstDiff = int(a[i]) - int(b[j])
+			}
+			i++
+			j++
+		}
+		if i < len(a) && isDigit(a[i]) {
+			return 1
+		}
+		if j < len(b) && isDigit(b[j]) {
+			return -1
+		}
+		if firstDiff != 0 {
+			return sign(firstDiff)
+		}
+	}
+	return 0
+}
+
+// order returns the sort weight of the character at s[i]. Letters sort
+// before non-letters and the tilde sorts before anything, even the end of
+// the string.
+func order(s string, i int) int {
+	if i >= len(s) {
+		return 0
+	}
+	c := s[i]
+	switch {
+	case isDigit(c):
+		return 0
+	case isAlpha(c):
+		return int(c)
+	case c == '~':
+		return -1
+	}
+	return int(c) + 256
+}
+
+func sign(i int) int {
+	switch {
+	case i < 0:
+		return -1
+	case i > 0:
+		return 1
+	}
+	return 0
+}
+
+func isDigit(c byte) bool { return '0' <= c && c <= '9' }
+
+func isAlpha(c byte) bool { return ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z') }
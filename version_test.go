@@ -0,0 +1,153 @@
+package debrepo
+
+import "testing"
+
+func TestParseVersion(t *testing.T) {
+	tests := []struct {
+		str     string
+		version Version
+		valid   bool
+	}{
+		{"0", Version{0, "0", ""}, true},
+		{"0:0", Version{0, "0", ""}, true},
+		{"0:0-", Version{}, false},
+		{"0:0-0", Version{0, "0", "0"}, true},
+		{"0:0.0-0.0", Version{0, "0.0", "0.0"}, true},
+		{"1:2.3~rc1-1ubuntu2", Version{1, "2.3~rc1", "1ubuntu2"}, true},
+		{"1.0-a-b", Version{0, "1.0-a", "b"}, true},
+		{"1:2:3", Version{1, "2:3", ""}, true},
+		{"  1.0  ", Version{0, "1.0", ""}, true},
+		{"2147483647:1.0", Version{2147483647, "1.0", ""}, true},
+		{"", Version{}, false},
+		{"  ", Version{}, false},
+		{"0:", Version{}, false},
+		{":1.0", Version{}, false},
+		{"a:1.0", Version{}, false},
+		{"-1:1.0", Version{}, false},
+		{"2147483648:1.0", Version{}, false},
+		{"999999999999999999999:1.0", Version{}, false},
+		{"1.0-", Version{}, false},
+		{"1.0-1-", Version{}, false},
+		{"0 1", Version{}, false},
+		{"a1.0", Version{}, false},
+		{"-1.0", Version{}, false},
+		{"1.0@", Version{}, false},
+		{"1.0-1:2", Version{}, false},
+		{"1.0-1_2", Version{}, false},
+	}
+	for i, tt := range tests {
+		v, err := ParseVersion(tt.str)
+		if expected, actual := tt.valid, err == nil; expected != actual {
+			t.Fatalf("test(%v) %q: expected valid=%v actual=%v", i, tt.str, expected, actual)
+		}
+		if !tt.valid && err != InvalidVersion {
+			t.Fatalf("test(%v) %q: expected=%v actual=%v", i, tt.str, InvalidVersion, err)
+		}
+		if expected, actual := tt.version, v; expected != actual {
+			t.Fatalf("test(%v) %q: expected=%+v actual=%+v", i, tt.str, expected, actual)
+		}
+	}
+}
+
+func TestVersion_String(t *testing.T) {
+	tests := []struct {
+		version Version
+		str     string
+	}{
+		{Version{0, "1.0", ""}, "1.0"},
+		{Version{0, "1.0", "1"}, "1.0-1"},
+		{Version{2, "1.0-a", "b"}, "2:1.0-a-b"},
+	}
+	for i, tt := range tests {
+		if expected, actual := tt.str, tt.version.String(); expected != actual {
+			t.Fatalf("test(%v): expected=%v actual=%v", i, expected, actual)
+		}
+	}
+}
+
+// versionCompareTests are taken from the dpkg test suite, along with the
+// tilde ordering examples from Debian policy.
+var versionCompareTests = []struct {
+	a, b     string
+	expected int
+}{
+	{"1.0", "1.0", 0},
+	{"1.0", "2.0", -1},
+	{"2.0", "1.0", 1},
+	{"0:1-1", "0:2-1", -1},
+	{"0:1-1", "0:1-2", -1},
+	{"0:1-1", "1:0-0", -1},
+	{"1.0-1", "2.0-2", -1},
+	{"2.2~rc-4", "2.2-1", -1},
+	{"2.2-1", "2.2~rc-4", 1},
+	{"1.0000-1", "1.0-1", 0},
+	{"1", "0:1", 0},
+	{"0", "0:0-0", 0},
+	{"2:2.5", "1:7.5", 1},
+	{"1:0foo", "0foo", 1},
+	{"0:0foo", "0foo", 0},
+	{"0foo", "0foo", 0},
+	{"0foo-0", "0foo", 0},
+	{"0foo", "0foo-0", 0},
+	{"0foo", "0fo", 1},
+	{"0foo-0", "0foo+", -1},
+	{"0foo~1", "0foo", -1},
+	{"0foo~foo+Bar", "0foo~foo+bar", -1},
+	{"0foo~~", "0foo~", -1},
+	{"1~", "1", -1},
+	{"12345+that-really-is-some-ver-0", "12345+that-really-is-some-ver-10", -1},
+	{"0foo-0", "0foo-01", -1},
+	{"0foo.bar", "0foobar", 1},
+	{"0foo.bar", "0foo1bar", 1},
+	{"0foo.bar", "0foo0bar", 1},
+	{"0foo1bar-1", "0foobar-1", -1},
+	{"0foo2.0", "0foo2", 1},
+	{"0foo2.0.0", "0foo2.10.0", -1},
+	{"0foo2.0", "0foo2.0.0", -1},
+	{"0foo2.0", "0foo2.10", -1},
+	{"0foo2.1", "0foo2.10", -1},
+	{"1.09", "1.9", 0},
+	{"1.0.8+nmu1", "1.0.8", 1},
+	{"3.11", "3.10+nmu1", 1},
+	{"0.9j-20080306-4", "0.9i-20070324-2", 1},
+	{"1.2.0~b7-1", "1.2.0~b6-1", 1},
+	{"1.011-1", "1.06-2", 1},
+	{"0.0.9+dfsg1-1", "0.0.8+dfsg1-3", 1},
+	{"4.6.99+svn6582-1", "4.6.99+svn6496-1", 1},
+	{"53", "52", 1},
+	{"0.9.9~pre122-1", "0.9.9~pre111-1", 1},
+	{"2:2.3.2-2+lenny2", "2:2.3.2-2", 1},
+	{"1:3.8.1-1", "3.8.GA-1", 1},
+	{"1.0.1+gpl-1", "1.0.1-2", 1},
+	{"1a", "1000a", -1},
+	// Debian policy: ~~ < ~~a < ~ < (empty) < a
+	{"1~~", "1~~a", -1},
+	{"1~~a", "1~", -1},
+	{"1~", "1", -1},
+	{"1", "1a", -1},
+}
+
+func TestVersion_Compare(t *testing.T) {
+	for i, tt := range versionCompareTests {
+		actual, err := CompareVersions(tt.a, tt.b)
+		if err != nil {
+			t.Fatalf("test(%v): %v", i, err)
+		}
+		if expected := tt.expected; expected != actual {
+			t.Fatalf("test(%v): %s vs %s: expected=%v actual=%v", i, tt.a, tt.b, expected, actual)
+		}
+		reverse, _ := CompareVersions(tt.b, tt.a)
+		if expected, actual := -tt.expected, reverse; expected != actual {
+			t.Fatalf("test(%v): %s vs %s: expected=%v actual=%v", i, tt.b, tt.a, expected, actual)
+		}
+	}
+}
+
+func TestCompareVersions_Invalid(t *testing.T) {
+	if _, err := CompareVersions("1.0", "a"); err != InvalidVersion {
+		t.Fatalf("expected=%v actual=%v", InvalidVersion, err)
+	}
+	if _, err := CompareVersions("", "1.0"); err != InvalidVersion {
+		t.Fatalf("expected=%v actual=%v", InvalidVersion, err)
+	}
+}